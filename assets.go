@@ -0,0 +1,38 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// the views and static assets are built into the binary, so that it runs
+// from any directory without the project alongside
+var (
+	//go:embed views
+	embeddedViews embed.FS
+	//go:embed public
+	embeddedPublic embed.FS
+)
+
+// assetsFS returns the files of dir: the embedded copy, or in DEBUG the
+// directory under root, so that edits show without a rebuild. A binary run
+// in DEBUG away from the project falls back to the embedded files.
+func assetsFS(embedded embed.FS, root, dir string, debug bool) fs.FS {
+	if debug {
+		path := filepath.Join(root, dir)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			slog.Debug("serving files from disk", "dir", path)
+			return os.DirFS(path)
+		}
+		slog.Warn("directory not found, using the embedded files", "dir", path)
+	}
+	sub, err := fs.Sub(embedded, dir)
+	if err != nil {
+		// dir is embedded, so this can't happen
+		panic(err)
+	}
+	return sub
+}
@@ -0,0 +1,262 @@
+// Package assets serves the static files of the application under
+// fingerprinted urls.
+//
+// At startup every file gets a name with a hash of its content, such as
+// images/celeritas.3f2a9c1b0d.jpg, which templates get from Path. Those urls
+// change with the content, so they are cached by browsers for good; the
+// plain names are still served, but revalidated with their ETag.
+//
+// Compressible files are served gzip or brotli encoded when the client
+// accepts it: from the .gz and .br files next to them when they exist, built
+// with make compress_assets, otherwise gzip compressed in memory at startup.
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// immutable is the caching of fingerprinted urls, whose content never
+// changes
+const immutable = "public, max-age=31536000, immutable"
+
+// compressible are the extensions worth compressing; images and fonts
+// already are
+var compressible = map[string]bool{
+	".css": true, ".js": true, ".mjs": true, ".json": true, ".map": true, ".svg": true,
+	".txt": true, ".html": true, ".xml": true, ".webmanifest": true, ".ico": true,
+}
+
+// Assets is the index of the static files
+type Assets struct {
+	fsys   fs.FS
+	prefix string
+	dev    bool
+	// files by name, and names by fingerprinted name
+	files  map[string]*file
+	hashed map[string]string
+}
+
+type file struct {
+	name    string
+	hashed  string
+	etag    string
+	modTime time.Time
+	// gzip is set when there is no .gz file to serve
+	gzip       []byte
+	hasGzip    bool
+	hasBrotli  bool
+	compressed bool
+}
+
+// New indexes the files of fsys, to be served under prefix. In dev the files
+// are not fingerprinted, and are read again on every request, so that edits
+// show without a restart.
+func New(fsys fs.FS, prefix string, dev bool) (*Assets, error) {
+	a := &Assets{
+		fsys:   fsys,
+		prefix: strings.TrimSuffix(prefix, "/"),
+		dev:    dev,
+		files:  make(map[string]*file),
+		hashed: make(map[string]string),
+	}
+	if dev {
+		return a, nil
+	}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || variant(name) {
+			return err
+		}
+		f, err := a.index(name)
+		if err != nil {
+			return fmt.Errorf("indexing asset %s: %w", name, err)
+		}
+		a.files[name] = f
+		a.hashed[f.hashed] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *Assets) index(name string) (*file, error) {
+	content, err := fs.ReadFile(a.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:5])
+	f := &file{
+		name:       name,
+		hashed:     fingerprint(name, hash),
+		etag:       `"` + hex.EncodeToString(sum[:16]) + `"`,
+		compressed: compressible[path.Ext(name)],
+	}
+	if info, err := fs.Stat(a.fsys, name); err == nil {
+		f.modTime = info.ModTime()
+	}
+	if !f.compressed {
+		return f, nil
+	}
+	f.hasBrotli = exists(a.fsys, name+".br")
+	f.hasGzip = exists(a.fsys, name+".gz")
+	if !f.hasGzip {
+		var b bytes.Buffer
+		zw, _ := gzip.NewWriterLevel(&b, gzip.BestCompression)
+		zw.Write(content)
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		f.gzip = b.Bytes()
+	}
+	return f, nil
+}
+
+// Path returns the url of the asset name, relative to the served directory:
+// fingerprinted, or plain in dev and for names that aren't assets
+func (a *Assets) Path(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if f, ok := a.files[name]; ok {
+		return a.prefix + "/" + f.hashed
+	}
+	return a.prefix + "/" + name
+}
+
+// Handler serves the assets, with the prefix already stripped from the
+// url. Directories and missing files are answered by notFound.
+func (a *Assets) Handler(notFound http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if a.dev {
+			a.serveDev(w, r, name, notFound)
+			return
+		}
+		f, ok := a.files[name]
+		cache := "no-cache"
+		if !ok {
+			if name, ok = a.hashed[name]; ok {
+				f, cache = a.files[name], immutable
+			}
+		}
+		if !ok {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", cache)
+		a.serve(w, r, f)
+	})
+}
+
+// serve writes f, or one of its encoded variants
+func (a *Assets) serve(w http.ResponseWriter, r *http.Request, f *file) {
+	h := w.Header()
+	if ctype := mime.TypeByExtension(path.Ext(f.name)); ctype != "" {
+		h.Set("Content-Type", ctype)
+	}
+	if !f.compressed {
+		h.Set("ETag", f.etag)
+		a.serveFile(w, r, f.name, f.name, f.modTime)
+		return
+	}
+
+	h.Add("Vary", "Accept-Encoding")
+	accepted := acceptedEncodings(r)
+	switch {
+	case f.hasBrotli && accepted["br"]:
+		h.Set("Content-Encoding", "br")
+		h.Set("ETag", strings.TrimSuffix(f.etag, `"`)+`-br"`)
+		a.serveFile(w, r, f.name, f.name+".br", f.modTime)
+	case (f.hasGzip || f.gzip != nil) && accepted["gzip"]:
+		h.Set("Content-Encoding", "gzip")
+		h.Set("ETag", strings.TrimSuffix(f.etag, `"`)+`-gzip"`)
+		if f.gzip != nil {
+			http.ServeContent(w, r, f.name, f.modTime, bytes.NewReader(f.gzip))
+			return
+		}
+		a.serveFile(w, r, f.name, f.name+".gz", f.modTime)
+	default:
+		h.Set("ETag", f.etag)
+		a.serveFile(w, r, f.name, f.name, f.modTime)
+	}
+}
+
+// serveFile writes the file source as name; http.ServeContent handles the
+// conditional and range requests
+func (a *Assets) serveFile(w http.ResponseWriter, r *http.Request, name, source string, modTime time.Time) {
+	fh, err := a.fsys.Open(source)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer fh.Close()
+	content, ok := fh.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(fh)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(b)
+	}
+	http.ServeContent(w, r, name, modTime, content)
+}
+
+// serveDev serves name as it is on disk now, revalidated every time
+func (a *Assets) serveDev(w http.ResponseWriter, r *http.Request, name string, notFound http.Handler) {
+	info, err := fs.Stat(a.fsys, name)
+	if err != nil || info.IsDir() || variant(name) {
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		notFound.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	a.serveFile(w, r, name, name, info.ModTime())
+}
+
+// fingerprint inserts hash before the extension of name
+func fingerprint(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// variant reports whether name is the compressed copy of another file
+func variant(name string) bool {
+	ext := path.Ext(name)
+	return (ext == ".gz" || ext == ".br") && compressible[path.Ext(strings.TrimSuffix(name, ext))]
+}
+
+func exists(fsys fs.FS, name string) bool {
+	info, err := fs.Stat(fsys, name)
+	return err == nil && !info.IsDir()
+}
+
+// acceptedEncodings returns the codings of Accept-Encoding not refused with
+// q=0
+func acceptedEncodings(r *http.Request) map[string]bool {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := strings.ReplaceAll(params, " ", "")
+		if q == "q=0" || q == "q=0.0" || q == "q=0.00" || q == "q=0.000" {
+			continue
+		}
+		accepted[strings.ToLower(coding)] = true
+	}
+	return accepted
+}
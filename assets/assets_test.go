@@ -0,0 +1,118 @@
+package assets
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"testing/fstest"
+)
+
+func testAssets(t *testing.T, dev bool) (*Assets, http.Handler) {
+	t.Helper()
+	a, err := New(fstest.MapFS{
+		"images/logo.jpg": {Data: []byte("not really a jpeg")},
+		"css/app.css":     {Data: []byte("body { margin: 0 }")},
+		"css/app.css.br":  {Data: []byte("brotli")},
+		"js/app.js":       {Data: []byte("console.log(1)")},
+	}, "/public", dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notFound := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { http.Error(w, "missing", http.StatusNotFound) })
+	return a, http.StripPrefix("/public", a.Handler(notFound))
+}
+
+func get(h http.Handler, url string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", url, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	return rr
+}
+
+func TestPath(t *testing.T) {
+	a, _ := testAssets(t, false)
+	if path := a.Path("images/logo.jpg"); !regexp.MustCompile(`^/public/images/logo\.[0-9a-f]{10}\.jpg$`).MatchString(path) {
+		t.Errorf("expected a fingerprinted url, got %q", path)
+	}
+	if path := a.Path("/missing.png"); path != "/public/missing.png" {
+		t.Errorf("expected the plain url of a missing asset, got %q", path)
+	}
+	dev, _ := testAssets(t, true)
+	if path := dev.Path("images/logo.jpg"); path != "/public/images/logo.jpg" {
+		t.Errorf("expected plain urls in dev, got %q", path)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	a, h := testAssets(t, false)
+
+	rr := get(h, a.Path("images/logo.jpg"))
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || rr.Body.String() != "not really a jpeg" ||
+		rr.Header().Get("Cache-Control") != immutable || rr.Header().Get("Content-Type") != "image/jpeg" || etag == "" {
+		t.Errorf("expected the file cached for good, got %d %v", rr.Code, rr.Header())
+	}
+	if rr := get(h, "/public/images/logo.jpg"); rr.Code != http.StatusOK || rr.Header().Get("Cache-Control") != "no-cache" ||
+		rr.Header().Get("ETag") != etag {
+		t.Errorf("expected the plain url revalidated, got %d %v", rr.Code, rr.Header())
+	}
+	if rr := get(h, "/public/images/logo.jpg", "If-None-Match", etag); rr.Code != http.StatusNotModified {
+		t.Errorf("expected a matching ETag to answer 304, got %d", rr.Code)
+	}
+
+	for _, url := range []string{"/public/", "/public/images/", "/public/images/logo.0000000000.jpg", "/public/css/app.css.br"} {
+		if rr := get(h, url); rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", url, rr.Code)
+		}
+	}
+}
+
+func TestHandler_Compression(t *testing.T) {
+	a, h := testAssets(t, false)
+
+	rr := get(h, a.Path("css/app.css"), "Accept-Encoding", "gzip, br")
+	if rr.Header().Get("Content-Encoding") != "br" || rr.Body.String() != "brotli" ||
+		rr.Header().Get("Content-Type") != "text/css; charset=utf-8" || rr.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("expected the brotli file, got %v %q", rr.Header(), rr.Body)
+	}
+
+	rr = get(h, a.Path("js/app.js"), "Accept-Encoding", "gzip, br")
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip without a brotli file, got %v", rr.Header())
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != "console.log(1)" {
+		t.Errorf("expected the gzipped script, got %q", body)
+	}
+	gzipped := rr.Header().Get("ETag")
+	if rr := get(h, a.Path("js/app.js"), "Accept-Encoding", "gzip", "If-None-Match", gzipped); rr.Code != http.StatusNotModified {
+		t.Errorf("expected the ETag of the gzipped variant to answer 304, got %d", rr.Code)
+	}
+
+	rr = get(h, a.Path("js/app.js"), "Accept-Encoding", "gzip;q=0, identity")
+	if rr.Header().Get("Content-Encoding") != "" || rr.Body.String() != "console.log(1)" || rr.Header().Get("ETag") == gzipped {
+		t.Errorf("expected the plain file when gzip is refused, got %v %q", rr.Header(), rr.Body)
+	}
+	if rr := get(h, a.Path("images/logo.jpg"), "Accept-Encoding", "gzip"); rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("expected images served as they are, got %v", rr.Header())
+	}
+}
+
+func TestHandler_Dev(t *testing.T) {
+	_, h := testAssets(t, true)
+	if rr := get(h, "/public/js/app.js"); rr.Code != http.StatusOK || rr.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("expected the file revalidated in dev, got %d %v", rr.Code, rr.Header())
+	}
+	if rr := get(h, "/public/js/"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected no directory listing in dev, got %d", rr.Code)
+	}
+}
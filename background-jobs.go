@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prateekjoshi2013/scotch-primer/jobs"
+	"github.com/prateekjoshi2013/scotch-primer/logging"
+)
+
+// job types
+const (
+	jobPurgeTokens = "tokens.purge_expired"
+)
+
+// purgeTokensJob deletes the api tokens that expired before Before
+type purgeTokensJob struct {
+	Before time.Time `json:"before"`
+}
+
+// registerJobs creates the job queue, registers the handler of every job
+// type and ties the workers to the lifecycle of the app. The workers only
+// run with serve and jobs work; other commands can still enqueue.
+func (a *application) registerJobs() {
+	cfg := a.Config.Jobs
+	a.Jobs = jobs.New(a.App.DB.Pool, a.Config.Database.Type, jobs.Options{
+		Workers:      cfg.Workers,
+		PollInterval: time.Duration(cfg.PollInterval) * time.Second,
+		MaxAttempts:  cfg.MaxAttempts,
+		Timeout:      time.Duration(cfg.Timeout) * time.Second,
+	})
+
+	jobs.Register(a.Jobs, jobPurgeTokens, func(ctx context.Context, job purgeTokensJob) error {
+		n, err := a.Models.Tokens.DeleteExpired(ctx, job.Before)
+		if err != nil {
+			return err
+		}
+		logging.FromContext(ctx).Info("purged expired tokens", "before", job.Before, "deleted", n)
+		return nil
+	})
+
+	if cfg.Workers > 0 {
+		a.OnStartup("jobs", a.Jobs.Start)
+	}
+	a.OnShutdown("jobs", a.Jobs.Stop)
+}
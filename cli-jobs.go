@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+func jobsCommand(a *application, out *output, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	if a.Jobs == nil {
+		return errors.New("the job queue needs a database, set DATABASE_TYPE")
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "work":
+		if a.Config.Jobs.Workers == 0 {
+			return errors.New("JOBS_WORKERS is 0, so there are no workers to run")
+		}
+		// runs the workers without the web server; the shutdown hooks stop
+		// them once a signal arrives
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := a.Jobs.Start(ctx); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		slog.Info("shutting down", "timeout", a.Config.ShutdownTimeoutDuration().String())
+		return nil
+
+	case "list":
+		status := ""
+		if len(args) > 1 {
+			status = args[1]
+		}
+		jobs, err := a.Jobs.List(ctx, status)
+		if err != nil {
+			return err
+		}
+		return out.print(jobs, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tTYPE\tSTATUS\tATTEMPTS\tRUN AT\tLAST ERROR")
+			for _, j := range jobs {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%d/%d\t%s\t%s\n", j.ID, j.Type, j.Status, j.Attempts, j.MaxAttempts,
+					j.RunAt.Format(time.RFC3339), j.LastError)
+			}
+		})
+
+	case "retry":
+		if len(args) != 2 {
+			return errUsage
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errUsage
+		}
+		if err := a.Jobs.Retry(ctx, id); err != nil {
+			return err
+		}
+		return out.message("queued job %d again", id)
+
+	case "enqueue":
+		if len(args) < 2 || len(args) > 3 {
+			return errUsage
+		}
+		payload := json.RawMessage("{}")
+		if len(args) == 3 {
+			payload = json.RawMessage(args[2])
+			if !json.Valid(payload) {
+				return fmt.Errorf("the payload must be json, got %s", args[2])
+			}
+		}
+		id, err := a.Jobs.Enqueue(ctx, args[1], payload)
+		if err != nil {
+			return err
+		}
+		return out.message("enqueued job %d", id)
+	}
+	return errUsage
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+func tasksCommand(a *application, out *output, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	if a.Scheduler == nil {
+		return errors.New("the maintenance tasks need a database, set DATABASE_TYPE")
+	}
+
+	switch args[0] {
+	case "list":
+		entries := a.Scheduler.Entries()
+		return out.print(entries, func(w io.Writer) {
+			fmt.Fprintln(w, "NAME\tSCHEDULE\tNEXT RUN")
+			for _, e := range entries {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", e.Name, e.Schedule, e.Next.Format(time.RFC3339))
+			}
+		})
+
+	case "run":
+		if len(args) != 2 {
+			return errUsage
+		}
+		if err := a.Scheduler.Run(context.Background(), args[1]); err != nil {
+			return err
+		}
+		return out.message("ran %s", args[1])
+	}
+	return errUsage
+}
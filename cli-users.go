@@ -0,0 +1,227 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/prateekjoshi2013/scotch-primer/data"
+)
+
+// userView is what the cli prints for a user; it leaves out the password hash
+type userView struct {
+	ID        int       `json:"id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newUserView(u *data.User) userView {
+	return userView{
+		ID:        u.ID,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Email:     u.Email,
+		Active:    u.Active == 1,
+		CreatedAt: u.CreatedAt,
+	}
+}
+
+// tokenView is what the cli lists for a token: its id and first characters,
+// which are enough to tell tokens apart without handing them out again
+type tokenView struct {
+	ID      int       `json:"id"`
+	UserID  int       `json:"user_id"`
+	Prefix  string    `json:"prefix"`
+	Expires time.Time `json:"expiry"`
+}
+
+func newTokenView(t *data.Token) tokenView {
+	prefix := t.PlainText
+	if len(prefix) > 6 {
+		prefix = prefix[:6]
+	}
+	return tokenView{ID: t.ID, UserID: t.UserID, Prefix: prefix + "...", Expires: t.Expires}
+}
+
+func userCommand(a *application, out *output, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "create":
+		fs := newFlagSet("user create")
+		var u data.User
+		fs.StringVar(&u.FirstName, "first", "", "first name")
+		fs.StringVar(&u.LastName, "last", "", "last name")
+		fs.StringVar(&u.Email, "email", "", "email address")
+		fs.StringVar(&u.Password, "password", "", "password")
+		inactive := fs.Bool("inactive", false, "create the user as inactive")
+		if err := fs.Parse(args[1:]); err != nil {
+			return errUsage
+		}
+		validator := a.App.Validator(nil)
+		u.Validate(validator)
+		validator.Check(u.Password != "", "password", "Password cannot be empty")
+		if !validator.Valid() {
+			return fmt.Errorf("invalid user: %v", validator.Errors)
+		}
+		u.Active = 1
+		if *inactive {
+			u.Active = 0
+		}
+		id, err := a.Models.Users.Insert(u)
+		if err != nil {
+			return err
+		}
+		return out.message("created user %d", id)
+
+	case "list":
+		users, err := a.Models.Users.GetAll()
+		if err != nil {
+			return err
+		}
+		views := make([]userView, 0, len(users))
+		for _, u := range users {
+			views = append(views, newUserView(u))
+		}
+		return out.print(views, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tNAME\tEMAIL\tACTIVE")
+			for _, u := range views {
+				fmt.Fprintf(w, "%d\t%s %s\t%s\t%t\n", u.ID, u.FirstName, u.LastName, u.Email, u.Active)
+			}
+		})
+
+	case "deactivate":
+		u, err := userArg(a, args[1:])
+		if err != nil {
+			return err
+		}
+		u.Active = 0
+		if err := a.Models.Users.Update(u); err != nil {
+			return err
+		}
+		// a deactivated user must not keep using the api
+		tokens, err := a.Models.Tokens.GetTokensForUser(u.ID)
+		if err != nil {
+			return err
+		}
+		for _, t := range tokens {
+			if err := a.Models.Tokens.Delete(t.ID); err != nil {
+				return err
+			}
+		}
+		return out.message("deactivated user %d", u.ID)
+
+	case "reset-password":
+		if len(args) < 2 {
+			return errUsage
+		}
+		u, err := userArg(a, args[1:2])
+		if err != nil {
+			return err
+		}
+		fs := newFlagSet("user reset-password")
+		password := fs.String("password", "", "the new password")
+		if err := fs.Parse(args[2:]); err != nil || *password == "" {
+			return errUsage
+		}
+		if err := a.Models.Users.ResetPassword(u.ID, *password); err != nil {
+			return err
+		}
+		return out.message("reset password of user %d", u.ID)
+	}
+	return errUsage
+}
+
+func tokenCommand(a *application, out *output, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "issue":
+		if len(args) < 2 {
+			return errUsage
+		}
+		u, err := userArg(a, args[1:2])
+		if err != nil {
+			return err
+		}
+		fs := newFlagSet("token issue")
+		ttl := fs.Duration("ttl", 24*time.Hour, "how long the token is valid")
+		if err := fs.Parse(args[2:]); err != nil {
+			return errUsage
+		}
+		token, err := a.Models.Tokens.GenerateToken(u.ID, *ttl)
+		if err != nil {
+			return err
+		}
+		if err := a.Models.Tokens.Insert(*token, *u); err != nil {
+			return err
+		}
+		return out.print(token, func(w io.Writer) {
+			fmt.Fprintf(w, "%s\texpires %s\n", token.PlainText, token.Expires.Format(time.RFC3339))
+		})
+
+	case "list":
+		u, err := userArg(a, args[1:])
+		if err != nil {
+			return err
+		}
+		tokens, err := a.Models.Tokens.GetTokensForUser(u.ID)
+		if err != nil {
+			return err
+		}
+		views := make([]tokenView, 0, len(tokens))
+		for _, t := range tokens {
+			views = append(views, newTokenView(t))
+		}
+		return out.print(views, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tPREFIX\tEXPIRES")
+			for _, t := range views {
+				fmt.Fprintf(w, "%d\t%s\t%s\n", t.ID, t.Prefix, t.Expires.Format(time.RFC3339))
+			}
+		})
+
+	case "revoke":
+		if len(args) != 2 {
+			return errUsage
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return errUsage
+		}
+		if _, err := a.Models.Tokens.Get(id); err != nil {
+			return err
+		}
+		if err := a.Models.Tokens.Delete(id); err != nil {
+			return err
+		}
+		return out.message("revoked token %d", id)
+	}
+	return errUsage
+}
+
+// userArg loads the user whose id is the single element of args
+func userArg(a *application, args []string) (*data.User, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, errUsage
+	}
+	return a.Models.Users.Get(id)
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
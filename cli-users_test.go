@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prateekjoshi2013/scotch-primer/data"
+)
+
+func TestUserCommands_MissingArguments(t *testing.T) {
+	a := &application{}
+	out := &output{w: io.Discard}
+	tests := []struct {
+		cmd  command
+		args []string
+	}{
+		{userCommand, nil},
+		{userCommand, []string{"deactivate"}},
+		{userCommand, []string{"reset-password"}},
+		{userCommand, []string{"reset-password", "x", "-password", "secret"}},
+		{tokenCommand, nil},
+		{tokenCommand, []string{"issue"}},
+		{tokenCommand, []string{"issue", "-ttl", "1h"}},
+		{tokenCommand, []string{"list"}},
+		{tokenCommand, []string{"revoke"}},
+		{tokenCommand, []string{"revoke", "ABCDEF"}},
+	}
+	for _, tt := range tests {
+		if err := tt.cmd(a, out, tt.args); !errors.Is(err, errUsage) {
+			t.Errorf("%v: expected the usage error, got %v", tt.args, err)
+		}
+	}
+}
+
+func TestNewTokenView(t *testing.T) {
+	v := newTokenView(&data.Token{ID: 3, UserID: 1, PlainText: "ABCDEFGHIJKLMNOPQRSTUVWXYZ"})
+	if v.ID != 3 || v.Prefix != "ABCDEF..." {
+		t.Errorf("expected the id and the first characters of the token, got %+v", v)
+	}
+	out, _ := json.Marshal(v)
+	if strings.Contains(string(out), "GHIJ") {
+		t.Errorf("expected the json not to hold the token, got %s", out)
+	}
+}
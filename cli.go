@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/prateekjoshi2013/scotch-primer/data"
+	"github.com/prateekjoshi2013/scotch-primer/migrations"
+)
+
+const usage = `usage: scotchApp [-json] <command> [arguments]
+
+commands:
+  serve                                  start the web server (default)
+  migrate up                             apply all pending migrations
+  migrate down [n]                       roll back the last n migrations (default 1)
+  migrate status                         list migrations and whether they are applied
+  migrate force <version>                mark migrations up to version as applied
+  user create -first -last -email -password [-inactive]
+  user list
+  user deactivate <id>
+  user reset-password <id> -password <password>
+  token issue <user id> [-ttl 24h]
+  token list <user id>
+  token revoke <token id>
+  seed                                   insert a default user to log in with
+  keys rotate                            re-encrypt personal data under KEY, after
+                                         moving the old key to KEY_PREVIOUS, or
+                                         encrypt the data written before KEY was set
+  jobs work                              run the job workers without the web server
+  jobs list [queued|running|dead]
+  jobs retry <id>                        queue a dead job again
+  jobs enqueue <type> [json payload]
+  tasks list                             list the maintenance tasks and their schedules
+  tasks run <name>                       run a maintenance task now
+`
+
+var errUsage = errors.New("invalid arguments")
+
+// command is a cli subcommand; args excludes the command name itself
+type command func(a *application, out *output, args []string) error
+
+var commands = map[string]command{
+	"serve":   serveCommand,
+	"migrate": migrateCommand,
+	"user":    userCommand,
+	"token":   tokenCommand,
+	"seed":    seedCommand,
+	"keys":    keysCommand,
+	"jobs":    jobsCommand,
+	"tasks":   tasksCommand,
+}
+
+// parseCommand parses the global flags and returns the command to run, so that
+// usage errors are reported before the application connects to anything
+func parseCommand(args []string) (command, *output, []string, error) {
+	fs := flag.NewFlagSet("scotchApp", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	asJSON := fs.Bool("json", false, "print output as json")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, nil, errUsage
+	}
+	args = fs.Args()
+
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		return nil, nil, nil, errUsage
+	}
+	return cmd, &output{w: os.Stdout, json: *asJSON}, args, nil
+}
+
+// output prints command results either as aligned text or as json
+type output struct {
+	w    io.Writer
+	json bool
+}
+
+// print writes v as json, or calls text to write the human readable form
+func (o *output) print(v interface{}, text func(w io.Writer)) error {
+	if o.json {
+		enc := json.NewEncoder(o.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(o.w, 0, 4, 2, ' ', 0)
+	text(tw)
+	return tw.Flush()
+}
+
+func (o *output) message(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	return o.print(map[string]string{"message": msg}, func(w io.Writer) {
+		fmt.Fprintln(w, msg)
+	})
+}
+
+func serveCommand(a *application, out *output, args []string) error {
+	slog.Info("starting server", "debug", a.App.Debug, "version", buildVersion())
+	return a.serve()
+}
+
+func migrateCommand(a *application, out *output, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	runner, err := migrations.New(a.App.DB.Pool, a.Config.Database.Type)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := runner.Up()
+		if err != nil {
+			return err
+		}
+		return out.message("applied %d migrations", n)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errUsage
+			}
+		}
+		n, err := runner.Down(steps)
+		if err != nil {
+			return err
+		}
+		return out.message("rolled back %d migrations", n)
+
+	case "status":
+		statuses, err := runner.Status()
+		if err != nil {
+			return err
+		}
+		return out.print(statuses, func(w io.Writer) {
+			fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+			for _, s := range statuses {
+				applied := "no"
+				if s.AppliedAt != nil {
+					applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+			}
+		})
+
+	case "force":
+		if len(args) < 2 {
+			return errUsage
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errUsage
+		}
+		if err := runner.Force(version); err != nil {
+			return err
+		}
+		return out.message("forced version %d", version)
+	}
+	return errUsage
+}
+
+// seedUser is created by the seed command, unless it already exists
+var seedUser = data.User{
+	FirstName: "Admin",
+	LastName:  "User",
+	Email:     "admin@example.com",
+	Active:    1,
+	Password:  "password",
+}
+
+func seedCommand(a *application, out *output, args []string) error {
+	_, err := a.Models.Users.GetByEmail(seedUser.Email)
+	if err == nil {
+		return out.message("%s already exists", seedUser.Email)
+	}
+	if !errors.Is(err, data.ErrNotFound) {
+		return err
+	}
+	id, err := a.Models.Users.Insert(seedUser)
+	if err != nil {
+		return err
+	}
+	return out.message("created user %d: %s", id, seedUser.Email)
+}
+
+func keysCommand(a *application, out *output, args []string) error {
+	if len(args) != 1 || args[0] != "rotate" {
+		return errUsage
+	}
+	n, err := a.Models.Reencrypt()
+	if err != nil {
+		return err
+	}
+	return out.message("re-encrypted %d records", n)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.tmpl"))
+
+var identifier = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+type fieldType struct {
+	goType  string
+	example string
+	sql     map[string]string
+}
+
+var fieldTypes = map[string]fieldType{
+	"string": {"string", `"some string"`, map[string]string{"postgres": "character varying(255)", "mysql": "varchar(255)", "sqlite": "varchar(255)"}},
+	"text":   {"string", `"some text"`, map[string]string{"postgres": "text", "mysql": "text", "sqlite": "text"}},
+	"int":    {"int", "1", map[string]string{"postgres": "integer", "mysql": "int", "sqlite": "integer"}},
+	"int64":  {"int64", "1", map[string]string{"postgres": "bigint", "mysql": "bigint", "sqlite": "integer"}},
+	"bool":   {"bool", "true", map[string]string{"postgres": "boolean", "mysql": "tinyint(1)", "sqlite": "boolean"}},
+	"float":  {"float64", "1.5", map[string]string{"postgres": "double precision", "mysql": "double", "sqlite": "real"}},
+	"time":   {"time.Time", "time.Now()", map[string]string{"postgres": "timestamp without time zone", "mysql": "timestamp", "sqlite": "timestamp"}},
+}
+
+type field struct {
+	GoName  string
+	GoType  string
+	Column  string
+	Example string
+	kind    string
+	SQLType string
+}
+
+type model struct {
+	Name     string
+	Type     string
+	Plural   string
+	Var      string
+	Table    string
+	Receiver string
+	Fields   []field
+}
+
+func (m model) HasTime() bool {
+	for _, f := range m.Fields {
+		if f.kind == "time" {
+			return true
+		}
+	}
+	return false
+}
+
+func newModel(name string, args []string) (model, error) {
+	if !identifier.MatchString(name) {
+		return model{}, fmt.Errorf("invalid model name %q", name)
+	}
+	snake := toSnake(name)
+	m := model{
+		Name:     strings.ReplaceAll(snake, "_", " "),
+		Type:     toCamel(snake),
+		Plural:   toCamel(plural(snake)),
+		Var:      lowerFirst(toCamel(plural(snake))),
+		Table:    plural(snake),
+		Receiver: snake[:1],
+	}
+
+	seen := map[string]bool{"id": true, "created_at": true, "updated_at": true}
+	for _, arg := range args {
+		column, kind, ok := strings.Cut(arg, ":")
+		if !ok {
+			kind = "string"
+		}
+		column = toSnake(column)
+		if !identifier.MatchString(column) {
+			return model{}, fmt.Errorf("invalid field name %q", arg)
+		}
+		if seen[column] {
+			return model{}, fmt.Errorf("duplicate field %q", column)
+		}
+		seen[column] = true
+		t, ok := fieldTypes[kind]
+		if !ok {
+			return model{}, fmt.Errorf("unknown type %q for field %s", kind, column)
+		}
+		m.Fields = append(m.Fields, field{
+			GoName:  toCamel(column),
+			GoType:  t.goType,
+			Column:  column,
+			Example: t.example,
+			kind:    kind,
+		})
+	}
+	return m, nil
+}
+
+// dialects are the databases the app runs on; every model gets its
+// migrations for each of them
+var dialects = []string{"postgres", "mysql", "sqlite"}
+
+// generate writes the files for m below root and wires it into data.Models,
+// returning the paths it created. Nothing is overwritten.
+func generate(root string, m model) ([]string, error) {
+	type file struct {
+		path     string
+		template string
+		data     model
+		gofmt    bool
+	}
+	files := []file{
+		{filepath.Join(root, "data", toSnake(m.Type)+".go"), "model.go.tmpl", m, true},
+		{filepath.Join(root, "data", toSnake(m.Type)+"_integration_test.go"), "model_test.go.tmpl", m, true},
+	}
+	version := time.Now().UnixMicro()
+	for _, dialect := range dialects {
+		dm := m
+		dm.Fields = make([]field, len(m.Fields))
+		for i, f := range m.Fields {
+			f.SQLType = fieldTypes[f.kind].sql[dialect]
+			dm.Fields[i] = f
+		}
+		migration := filepath.Join(root, "migrations", fmt.Sprintf("%d_create_%s_table.%s", version, m.Table, dialect))
+		files = append(files,
+			file{migration + ".up.sql", dialect + ".up.sql.tmpl", dm, false},
+			file{migration + ".down.sql", "down.sql.tmpl", dm, false},
+		)
+	}
+
+	for _, f := range files {
+		if _, err := os.Stat(f.path); err == nil {
+			return nil, fmt.Errorf("%s already exists", f.path)
+		}
+	}
+
+	modelsPath := filepath.Join(root, "data", "models.go")
+	models, err := os.ReadFile(modelsPath)
+	if err != nil {
+		return nil, err
+	}
+	models, err = register(models, m)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []string
+	for _, f := range files {
+		var buf bytes.Buffer
+		if err := templates.ExecuteTemplate(&buf, f.template, f.data); err != nil {
+			return created, err
+		}
+		out := buf.Bytes()
+		if f.gofmt {
+			out, err = format.Source(out)
+			if err != nil {
+				return created, fmt.Errorf("%s: %w", f.path, err)
+			}
+		}
+		if err := os.WriteFile(f.path, out, 0644); err != nil {
+			return created, err
+		}
+		created = append(created, f.path)
+	}
+
+	return created, os.WriteFile(modelsPath, models, 0644)
+}
+
+// register adds m to the Models struct and to the value returned by New
+func register(src []byte, m model) ([]byte, error) {
+	s := string(src)
+	if regexp.MustCompile(`\b` + m.Plural + `\s+` + m.Type + `\b`).MatchString(s) {
+		return nil, fmt.Errorf("%s is already registered in data.Models", m.Type)
+	}
+
+	s, err := insertBefore(s, "type Models struct {", "\n}", fmt.Sprintf("\n\t%s %s", m.Plural, m.Type))
+	if err != nil {
+		return nil, err
+	}
+	s, err = insertBefore(s, "return Models{", "\n\t}", fmt.Sprintf("\n\t\t%s: %s{},", m.Plural, m.Type))
+	if err != nil {
+		return nil, err
+	}
+	return format.Source([]byte(s))
+}
+
+// insertBefore inserts text just before the first end that follows start
+func insertBefore(s, start, end, text string) (string, error) {
+	i := strings.Index(s, start)
+	if i < 0 {
+		return "", errors.New("could not find " + start + " in data/models.go")
+	}
+	j := strings.Index(s[i:], end)
+	if j < 0 {
+		return "", errors.New("could not find the end of " + start + " in data/models.go")
+	}
+	j += i
+	return s[:j] + text + s[j:], nil
+}
+
+// toSnake turns a Go name into a column name, keeping acronyms in one
+// piece: APIKey is api_key and UserID user_id
+func toSnake(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if isUpper(r) {
+			if i > 0 && s[i-1] != '_' && (!isUpper(rune(s[i-1])) || i+1 < len(s) && isLower(rune(s[i+1]))) {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isUpper(r rune) bool { return r >= 'A' && r <= 'Z' }
+
+func isLower(r rune) bool { return r >= 'a' && r <= 'z' }
+
+func toCamel(s string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(s, "_") {
+		if part == "" {
+			continue
+		}
+		if part == "id" {
+			b.WriteString("ID")
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+func lowerFirst(s string) string {
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func plural(s string) string {
+	switch {
+	case strings.HasSuffix(s, "y") && len(s) > 1 && !strings.ContainsAny(s[len(s)-2:len(s)-1], "aeiou"):
+		return s[:len(s)-1] + "ies"
+	case strings.HasSuffix(s, "s"), strings.HasSuffix(s, "x"), strings.HasSuffix(s, "ch"), strings.HasSuffix(s, "sh"):
+		return s + "es"
+	default:
+		return s + "s"
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNewModel(t *testing.T) {
+	m, err := newModel("BlogEntry", []string{"title", "user_id:int", "published_at:time"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != "BlogEntry" || m.Plural != "BlogEntries" || m.Table != "blog_entries" {
+		t.Errorf("unexpected names %s %s %s", m.Type, m.Plural, m.Table)
+	}
+	if m.Fields[0].GoType != "string" || m.Fields[1].GoName != "UserID" || !m.HasTime() {
+		t.Errorf("unexpected fields %+v", m.Fields)
+	}
+
+	for _, args := range [][]string{{"price:money"}, {"id:int"}, {"a:int", "a:string"}} {
+		if _, err := newModel("widget", args); err == nil {
+			t.Errorf("expected an error for %v", args)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"data", "migrations"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	models, err := os.ReadFile("../../data/models.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "data", "models.go"), models, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, _ := newModel("widget", []string{"name:string", "price:float"})
+	files, err := generate(root, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 8 {
+		t.Errorf("expected the model, its test and 3 pairs of migrations, got %v", files)
+	}
+	for _, dialect := range dialects {
+		up, err := filepath.Glob(filepath.Join(root, "migrations", "*_create_widgets_table."+dialect+".up.sql"))
+		if err != nil || len(up) != 1 {
+			t.Fatalf("expected one %s migration, got %v", dialect, up)
+		}
+		sql, _ := os.ReadFile(up[0])
+		if want := fieldTypes["float"].sql[dialect]; !strings.Contains(string(sql), "price "+want) {
+			t.Errorf("expected the %s migration to use %s, got %s", dialect, want, sql)
+		}
+	}
+
+	models, _ = os.ReadFile(filepath.Join(root, "data", "models.go"))
+	// gofmt aligns the value with the other models
+	if !regexp.MustCompile(`Widgets:\s+Widget\{\},`).Match(models) {
+		t.Error("widget was not registered in New")
+	}
+
+	if _, err := generate(root, m); err == nil {
+		t.Error("expected an error generating the same model twice")
+	}
+}
+
+func TestToSnake(t *testing.T) {
+	for in, want := range map[string]string{
+		"name":       "name",
+		"BlogEntry":  "blog_entry",
+		"userID":     "user_id",
+		"APIKey":     "api_key",
+		"HTTPServer": "http_server",
+		"ID":         "id",
+		"user_id":    "user_id",
+		"Version2":   "version2",
+	} {
+		if got := toSnake(in); got != want {
+			t.Errorf("toSnake(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
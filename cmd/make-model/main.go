@@ -0,0 +1,49 @@
+// Command make-model scaffolds a new model in the data package.
+//
+//	go run ./cmd/make-model [-root .] widget name:string price:int
+//
+// It writes data/<name>.go, a skeleton integration test, the up and down
+// migrations for postgres, mysql and sqlite and registers the model in
+// data.Models.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	root := flag.String("root", ".", "root of the application")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: make-model [-root dir] <name> [field:type ...]")
+		fmt.Fprintln(os.Stderr, "field types: string, text, int, int64, bool, float, time")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	model, err := newModel(flag.Arg(0), flag.Args()[1:])
+	if err != nil {
+		exitWithError(err)
+	}
+
+	files, err := generate(*root, model)
+	if err != nil {
+		exitWithError(err)
+	}
+	for _, f := range files {
+		fmt.Println("created", f)
+	}
+	fmt.Println("updated", filepath.Join(*root, "data", "models.go"))
+}
+
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, "make-model:", err)
+	os.Exit(1)
+}
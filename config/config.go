@@ -0,0 +1,409 @@
+// Package config loads the application settings from the environment, the
+// .env file and secret files, and validates them before anything starts.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Config is the effective configuration. Each field is read from the
+// variable in its env tag, or from the file named by that variable with a
+// _FILE suffix, e.g. KEY_FILE=/run/secrets/key, falling back to the default
+// tag. Secret fields are redacted when the config is logged.
+type Config struct {
+	AppName    string `env:"APP_NAME" default:"myScotchApp"`
+	Debug      bool   `env:"DEBUG"`
+	Port       int    `env:"PORT" default:"4000"`
+	ServerName string `env:"SERVER_NAME" default:"localhost"`
+	Secure     bool   `env:"SECURE"`
+	// ShutdownTimeout is how many seconds in flight requests get on shutdown
+	ShutdownTimeout int    `env:"SHUTDOWN_TIMEOUT" default:"30"`
+	Renderer        string `env:"RENDERER" default:"jet"`
+	Key             string `env:"KEY" secret:"true"`
+	// PreviousKeys are the keys KEY replaced, still used to read the values
+	// encrypted with them until scotchApp keys rotate has run
+	PreviousKeys []string `env:"KEY_PREVIOUS" secret:"true"`
+	Cache        string   `env:"CACHE"`
+	SessionType  string   `env:"SESSION_TYPE" default:"cookie"`
+	// TrustedProxies are the addresses, or cidr ranges, of the proxies in
+	// front of the app, whose X-Forwarded-For is believed; empty believes
+	// none
+	TrustedProxies []string `env:"TRUSTED_PROXIES"`
+
+	Database  Database
+	Redis     Redis
+	Cookie    Cookie
+	SMTP      SMTP
+	Metrics   Metrics
+	Tracing   Tracing
+	Jobs      Jobs
+	Scheduler Scheduler
+	CSRF      CSRF
+	CORS      CORS
+	RateLimit RateLimit
+}
+
+type Database struct {
+	Type     string `env:"DATABASE_TYPE"`
+	Host     string `env:"DATABASE_HOST"`
+	Port     int    `env:"DATABASE_PORT"`
+	User     string `env:"DATABASE_USER"`
+	Password string `env:"DATABASE_PASS" secret:"true"`
+	Name     string `env:"DATABASE_NAME"`
+	SSLMode  string `env:"DATABASE_SSL_MODE" default:"disable"`
+}
+
+type Redis struct {
+	Host     string `env:"REDIS_HOST"`
+	Password string `env:"REDIS_PASSWORD" secret:"true"`
+	Prefix   string `env:"REDIS_PREFIX"`
+}
+
+type Cookie struct {
+	Name string `env:"COOKIE_NAME" default:"scotch"`
+	// Lifetime is in minutes
+	Lifetime int    `env:"COOKIE_LIFETIME" default:"1440"`
+	Persist  bool   `env:"COOKIE_PERSIST" default:"true"`
+	Secure   bool   `env:"COOKIE_SECURE"`
+	Domain   string `env:"COOKIE_DOMAIN"`
+}
+
+type SMTP struct {
+	Host       string `env:"SMTP_HOST"`
+	Username   string `env:"SMTP_USERNAME"`
+	Password   string `env:"SMTP_PASSWORD" secret:"true"`
+	Port       int    `env:"SMTP_PORT"`
+	Encryption string `env:"SMTP_ENCRYPTION" default:"none"`
+	From       string `env:"SMTP_FORM"`
+}
+
+type Metrics struct {
+	Enabled bool   `env:"METRICS_ENABLED"`
+	Token   string `env:"METRICS_TOKEN" secret:"true"`
+}
+
+type Tracing struct {
+	Exporter string `env:"OTEL_TRACES_EXPORTER" default:"none"`
+	File     string `env:"OTEL_TRACES_FILE"`
+}
+
+type Jobs struct {
+	// Workers is how many jobs this process runs at once; 0 only enqueues
+	Workers int `env:"JOBS_WORKERS" default:"2"`
+	// PollInterval is in seconds
+	PollInterval int `env:"JOBS_POLL_INTERVAL" default:"1"`
+	MaxAttempts  int `env:"JOBS_MAX_ATTEMPTS" default:"5"`
+	// Timeout is how many seconds a job may run
+	Timeout int `env:"JOBS_TIMEOUT" default:"300"`
+}
+
+type Scheduler struct {
+	// Enabled runs the maintenance tasks on their schedules with serve
+	Enabled bool `env:"SCHEDULER_ENABLED" default:"true"`
+}
+
+type CSRF struct {
+	// Enabled checks the csrf token of the unsafe requests of browsers
+	Enabled bool `env:"CSRF_ENABLED" default:"true"`
+}
+
+// CORS are the cross origin requests the api accepts from browsers; the
+// other routes don't accept any
+type CORS struct {
+	// AllowedOrigins may use * for any origin, or in the host, as in
+	// https://*.example.com; empty refuses every origin
+	AllowedOrigins   []string `env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods   []string `env:"CORS_ALLOWED_METHODS" default:"GET,POST,PUT,PATCH,DELETE"`
+	AllowedHeaders   []string `env:"CORS_ALLOWED_HEADERS" default:"Authorization,Content-Type"`
+	ExposedHeaders   []string `env:"CORS_EXPOSED_HEADERS" default:"X-Request-ID"`
+	AllowCredentials bool     `env:"CORS_ALLOW_CREDENTIALS"`
+	// MaxAge is how many seconds browsers cache a preflight response
+	MaxAge int `env:"CORS_MAX_AGE" default:"600"`
+}
+
+type RateLimit struct {
+	Enabled bool `env:"RATE_LIMIT_ENABLED" default:"true"`
+	// Store is memory, with limits per instance, or redis, shared by all
+	Store string `env:"RATE_LIMIT_STORE" default:"memory"`
+	// the limits are requests per minute; 0 turns the policy off
+	Default int `env:"RATE_LIMIT_DEFAULT" default:"300"`
+	Login   int `env:"RATE_LIMIT_LOGIN" default:"10"`
+	API     int `env:"RATE_LIMIT_API" default:"120"`
+}
+
+// Problem is one thing wrong with the configuration
+type Problem struct {
+	Key     string
+	Message string
+}
+
+// Problems is returned by Load when the configuration is invalid, so that
+// everything can be fixed in one go rather than one error per restart
+type Problems []Problem
+
+func (p Problems) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid configuration:")
+	for _, problem := range p {
+		fmt.Fprintf(&b, "\n  %s: %s", problem.Key, problem.Message)
+	}
+	return b.String()
+}
+
+func (p *Problems) add(key, format string, args ...interface{}) {
+	*p = append(*p, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+// Load reads envFile, if it exists, then loads and validates the config.
+// Variables already set in the environment win over the file. Values read
+// from _FILE secrets and defaults are exported to the environment, since
+// scotch reads its own settings from there.
+func Load(envFile string) (*Config, error) {
+	if err := godotenv.Load(envFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading %s: %w", envFile, err)
+	}
+
+	c, values, err := parse(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range values {
+		if current, ok := os.LookupEnv(key); !ok || current != value {
+			os.Setenv(key, value)
+		}
+	}
+	return c, nil
+}
+
+// parse builds the config from lookup and returns it with the value used for
+// every key, or the Problems found
+func parse(lookup func(string) (string, bool)) (*Config, map[string]string, error) {
+	c := &Config{}
+	values := make(map[string]string)
+	var problems Problems
+
+	eachField(reflect.ValueOf(c).Elem(), func(f reflect.StructField, v reflect.Value) {
+		key := f.Tag.Get("env")
+		value, err := lookupValue(lookup, key, f.Tag.Get("default"))
+		if err != nil {
+			problems.add(key, "%s", err)
+			return
+		}
+		values[key] = value
+		if value == "" {
+			return
+		}
+
+		switch v.Kind() {
+		case reflect.String:
+			v.SetString(value)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				problems.add(key, "must be true or false, got %q", value)
+				return
+			}
+			v.SetBool(b)
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				problems.add(key, "must be a number, got %q", value)
+				return
+			}
+			v.SetInt(int64(n))
+		case reflect.Slice:
+			// comma separated strings
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			v.Set(reflect.ValueOf(items))
+		}
+	})
+
+	problems = append(problems, c.validate(problems)...)
+	if len(problems) > 0 {
+		return nil, nil, problems
+	}
+	return c, values, nil
+}
+
+// lookupValue returns the value of key, read from the file named by
+// key_FILE if that is set
+func lookupValue(lookup func(string) (string, bool), key, def string) (string, error) {
+	if path, ok := lookup(key + "_FILE"); ok && path != "" {
+		if v, _ := lookup(key); v != "" {
+			return "", fmt.Errorf("both %s and %s_FILE are set", key, key)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading %s_FILE: %w", key, err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	if value, ok := lookup(key); ok && value != "" {
+		return value, nil
+	}
+	return def, nil
+}
+
+// eachField calls fn for every tagged field of v, descending into the
+// nested structs
+func eachField(v reflect.Value, fn func(reflect.StructField, reflect.Value)) {
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.Type.Kind() == reflect.Struct {
+			eachField(v.Field(i), fn)
+			continue
+		}
+		if f.Tag.Get("env") != "" {
+			fn(f, v.Field(i))
+		}
+	}
+}
+
+// developmentKey is the KEY of the committed .env. Anyone can read it, so it
+// encrypts nothing worth protecting and is refused outside DEBUG.
+const developmentKey = "dev-only-key-change-me-012345678"
+
+// validate checks the values that parsed against each other and against the
+// values scotch accepts. Keys that already failed to parse are skipped.
+func (c *Config) validate(parsed Problems) Problems {
+	failed := make(map[string]bool)
+	for _, p := range parsed {
+		failed[p.Key] = true
+	}
+	var p Problems
+	check := func(key string, ok bool, format string, args ...interface{}) {
+		if !failed[key] && !ok {
+			p.add(key, format, args...)
+		}
+	}
+
+	check("APP_NAME", !strings.ContainsAny(c.AppName, " \t"), "must not contain spaces")
+	check("KEY", len(c.Key) == 32, "must be exactly 32 characters, got %d", len(c.Key))
+	check("KEY", c.Debug || c.Key != developmentKey,
+		"is the development key committed to the repository; generate one of your own outside DEBUG")
+	for i, k := range c.PreviousKeys {
+		check("KEY_PREVIOUS", len(k) == 32, "key %d must be exactly 32 characters, got %d", i+1, len(k))
+	}
+	check("PORT", validPort(c.Port), "must be a port between 1 and 65535, got %d", c.Port)
+	check("SHUTDOWN_TIMEOUT", c.ShutdownTimeout > 0, "must be a positive number of seconds")
+	check("COOKIE_LIFETIME", c.Cookie.Lifetime > 0, "must be a positive number of minutes")
+	check("RENDERER", oneOf(c.Renderer, "go", "jet"), "must be go or jet, got %q", c.Renderer)
+	check("CACHE", oneOf(c.Cache, "", "redis"), "must be empty or redis, got %q", c.Cache)
+	check("SESSION_TYPE", oneOf(c.SessionType, "cookie", "redis", "postgres", "postgresql", "mysql", "mariadb", "sqlite"),
+		"must be cookie, redis, postgres, mysql, mariadb or sqlite, got %q", c.SessionType)
+	check("OTEL_TRACES_EXPORTER", oneOf(c.Tracing.Exporter, "none", "stdout", "file"),
+		"must be none, stdout or file, got %q", c.Tracing.Exporter)
+	check("JOBS_WORKERS", c.Jobs.Workers >= 0, "must not be negative")
+	check("JOBS_POLL_INTERVAL", c.Jobs.PollInterval > 0, "must be a positive number of seconds")
+	check("JOBS_MAX_ATTEMPTS", c.Jobs.MaxAttempts > 0, "must be at least 1")
+	check("JOBS_TIMEOUT", c.Jobs.Timeout > 0, "must be a positive number of seconds")
+	for _, proxy := range c.TrustedProxies {
+		check("TRUSTED_PROXIES", validProxy(proxy), "must be addresses or cidr ranges, got %q", proxy)
+	}
+	check("CORS_MAX_AGE", c.CORS.MaxAge >= 0, "must not be negative")
+	for _, origin := range c.CORS.AllowedOrigins {
+		check("CORS_ALLOWED_ORIGINS", origin == "*" || strings.Contains(origin, "://"),
+			"origins must be * or scheme://host, got %q", origin)
+	}
+	if c.CORS.AllowCredentials {
+		for _, origin := range c.CORS.AllowedOrigins {
+			// any site could then make requests with the cookies of the user
+			check("CORS_ALLOW_CREDENTIALS", origin != "*", "can't be used with any origin allowed")
+		}
+	}
+	check("RATE_LIMIT_STORE", oneOf(c.RateLimit.Store, "memory", "redis"),
+		"must be memory or redis, got %q", c.RateLimit.Store)
+	check("RATE_LIMIT_DEFAULT", c.RateLimit.Default >= 0, "must not be negative")
+	check("RATE_LIMIT_LOGIN", c.RateLimit.Login >= 0, "must not be negative")
+	check("RATE_LIMIT_API", c.RateLimit.API >= 0, "must not be negative")
+	// the metrics tell the traffic, the routes and the failed logins of the
+	// app to anyone who can reach them
+	check("METRICS_TOKEN", !c.Metrics.Enabled || c.Metrics.Token != "", "is required when METRICS_ENABLED is true")
+	check("OTEL_TRACES_FILE", c.Tracing.Exporter != "file" || c.Tracing.File != "", "is required by the file exporter")
+
+	db := c.Database
+	check("DATABASE_TYPE", oneOf(db.Type, "", "postgres", "postgresql", "mysql", "mariadb", "sqlite"),
+		"must be empty, postgres, mysql, mariadb or sqlite, got %q", db.Type)
+	if db.Type != "" {
+		check("DATABASE_NAME", db.Name != "", "is required when DATABASE_TYPE is set")
+	}
+	if db.Type != "" && db.Type != "sqlite" {
+		check("DATABASE_HOST", db.Host != "", "is required when DATABASE_TYPE is %s", db.Type)
+		check("DATABASE_PORT", validPort(db.Port), "must be a port between 1 and 65535, got %d", db.Port)
+	}
+	if c.SMTP.Host != "" {
+		check("SMTP_PORT", validPort(c.SMTP.Port), "must be a port between 1 and 65535, got %d", c.SMTP.Port)
+	}
+
+	// the database backed session stores keep their sessions in the app database
+	switch c.SessionType {
+	case "postgres", "postgresql":
+		check("SESSION_TYPE", oneOf(db.Type, "postgres", "postgresql"), "%s sessions need DATABASE_TYPE=postgres", c.SessionType)
+	case "mysql", "mariadb":
+		check("SESSION_TYPE", oneOf(db.Type, "mysql", "mariadb"), "%s sessions need DATABASE_TYPE=mysql or mariadb", c.SessionType)
+	case "sqlite":
+		check("SESSION_TYPE", db.Type == "sqlite", "sqlite sessions need DATABASE_TYPE=sqlite")
+	}
+	rateLimitRedis := c.RateLimit.Enabled && c.RateLimit.Store == "redis"
+	if c.SessionType == "redis" || c.Cache == "redis" || rateLimitRedis {
+		check("REDIS_HOST", c.Redis.Host != "", "is required when sessions, the cache or the rate limits use redis")
+	}
+	return p
+}
+
+// ShutdownTimeoutDuration returns ShutdownTimeout as a duration
+func (c *Config) ShutdownTimeoutDuration() time.Duration {
+	return time.Duration(c.ShutdownTimeout) * time.Second
+}
+
+// LogValue logs every setting by its variable name, with secrets redacted
+func (c *Config) LogValue() slog.Value {
+	var attrs []slog.Attr
+	eachField(reflect.ValueOf(c).Elem(), func(f reflect.StructField, v reflect.Value) {
+		value := fmt.Sprint(v.Interface())
+		if v.Kind() == reflect.Slice {
+			value = strings.Join(v.Interface().([]string), ",")
+		}
+		if f.Tag.Get("secret") == "true" && value != "" {
+			value = "[redacted]"
+		}
+		attrs = append(attrs, slog.String(f.Tag.Get("env"), value))
+	})
+	return slog.GroupValue(attrs...)
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+func validProxy(proxy string) bool {
+	if _, err := netip.ParsePrefix(proxy); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(proxy)
+	return err == nil
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testKey = "0123456789abcdef0123456789abcdef"
+
+func lookupFrom(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func TestParse(t *testing.T) {
+	c, values, err := parse(lookupFrom(map[string]string{
+		"KEY":           testKey,
+		"PORT":          "8080",
+		"DEBUG":         "true",
+		"DATABASE_TYPE": "sqlite",
+		"DATABASE_NAME": "app.db",
+		"SESSION_TYPE":  "sqlite",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Port != 8080 || !c.Debug || c.Database.Name != "app.db" {
+		t.Errorf("unexpected config %+v", c)
+	}
+	if c.Renderer != "jet" || c.Cookie.Lifetime != 1440 || !c.Cookie.Persist {
+		t.Errorf("expected the defaults to be applied, got %+v", c)
+	}
+	if values["SHUTDOWN_TIMEOUT"] != "30" {
+		t.Errorf("expected the effective value of defaulted keys, got %q", values["SHUTDOWN_TIMEOUT"])
+	}
+}
+
+func TestParse_ReportsEveryProblem(t *testing.T) {
+	_, _, err := parse(lookupFrom(map[string]string{
+		"KEY":           "short",
+		"PORT":          "http",
+		"RENDERER":      "mustache",
+		"SESSION_TYPE":  "postgres",
+		"DATABASE_TYPE": "mysql",
+		"DATABASE_HOST": "localhost",
+		"DATABASE_PORT": "3306",
+		"DATABASE_NAME": "app",
+		"DEBUG":         "yes please",
+	}))
+
+	var problems Problems
+	if !errors.As(err, &problems) {
+		t.Fatalf("expected Problems, got %v", err)
+	}
+	var keys []string
+	for _, p := range problems {
+		keys = append(keys, p.Key)
+	}
+	want := "DEBUG,PORT,KEY,RENDERER,SESSION_TYPE"
+	if strings.Join(keys, ",") != want {
+		t.Errorf("expected problems with %s, got %s", want, strings.Join(keys, ","))
+	}
+	if !strings.Contains(err.Error(), `PORT: must be a number, got "http"`) {
+		t.Errorf("expected a readable report, got %s", err)
+	}
+}
+
+func TestParse_CORS(t *testing.T) {
+	c, _, err := parse(lookupFrom(map[string]string{
+		"KEY":                  testKey,
+		"CORS_ALLOWED_ORIGINS": "https://app.example.com, https://*.example.org",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.CORS.AllowedOrigins) != 2 || len(c.CORS.AllowedMethods) != 5 {
+		t.Errorf("expected the origins and the default methods, got %+v", c.CORS)
+	}
+
+	_, _, err = parse(lookupFrom(map[string]string{
+		"KEY":                    testKey,
+		"CORS_ALLOWED_ORIGINS":   "*",
+		"CORS_ALLOW_CREDENTIALS": "true",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "CORS_ALLOW_CREDENTIALS") {
+		t.Errorf("expected credentials to be refused for any origin, got %v", err)
+	}
+}
+
+func TestParse_MetricsToken(t *testing.T) {
+	_, _, err := parse(lookupFrom(map[string]string{"KEY": testKey, "METRICS_ENABLED": "true"}))
+	if err == nil || !strings.Contains(err.Error(), "METRICS_TOKEN") {
+		t.Errorf("expected the metrics to be refused without a token, got %v", err)
+	}
+	if _, _, err := parse(lookupFrom(map[string]string{"KEY": testKey, "METRICS_ENABLED": "true", "METRICS_TOKEN": "secret"})); err != nil {
+		t.Errorf("expected the metrics with a token to be accepted, got %v", err)
+	}
+}
+
+func TestParse_TrustedProxies(t *testing.T) {
+	c, _, err := parse(lookupFrom(map[string]string{"KEY": testKey, "TRUSTED_PROXIES": "10.0.0.0/8, 192.168.1.1, ::1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.TrustedProxies) != 3 {
+		t.Errorf("expected three trusted proxies, got %q", c.TrustedProxies)
+	}
+	_, _, err = parse(lookupFrom(map[string]string{"KEY": testKey, "TRUSTED_PROXIES": "proxy.internal"}))
+	if err == nil || !strings.Contains(err.Error(), "TRUSTED_PROXIES") {
+		t.Errorf("expected a host name to be refused, got %v", err)
+	}
+}
+
+func TestParse_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte(testKey+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, _, err := parse(lookupFrom(map[string]string{"KEY_FILE": path}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Key != testKey {
+		t.Errorf("expected the key from the file without its newline, got %q", c.Key)
+	}
+
+	_, _, err = parse(lookupFrom(map[string]string{"KEY_FILE": path, "KEY": testKey}))
+	if err == nil || !strings.Contains(err.Error(), "both KEY and KEY_FILE are set") {
+		t.Errorf("expected a conflict to be reported, got %v", err)
+	}
+}
+
+func TestLogValue(t *testing.T) {
+	c, _, err := parse(lookupFrom(map[string]string{"KEY": testKey, "DATABASE_PASS": "hunter2"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("config", "config", c)
+	out := buf.String()
+	if strings.Contains(out, testKey) || strings.Contains(out, "hunter2") {
+		t.Errorf("expected secrets to be redacted, got %s", out)
+	}
+	if !strings.Contains(out, "config.KEY=[redacted]") || !strings.Contains(out, "config.RENDERER=jet") {
+		t.Errorf("expected every setting by name, got %s", out)
+	}
+	if !strings.Contains(out, `config.METRICS_TOKEN=""`) {
+		t.Errorf("expected empty secrets to show as empty, got %s", out)
+	}
+}
+
+func TestParse_DevelopmentKey(t *testing.T) {
+	if _, _, err := parse(lookupFrom(map[string]string{"KEY": developmentKey, "DEBUG": "true"})); err != nil {
+		t.Errorf("expected the development key to be accepted in DEBUG, got %v", err)
+	}
+	_, _, err := parse(lookupFrom(map[string]string{"KEY": developmentKey, "DEBUG": "false"}))
+	if err == nil || !strings.Contains(err.Error(), "KEY: is the development key") {
+		t.Errorf("expected the development key to be refused outside DEBUG, got %v", err)
+	}
+}
@@ -1,6 +1,12 @@
 package main
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+
+	"github.com/prateekjoshi2013/scotch-primer/handlers"
+	"github.com/prateekjoshi2013/scotch-primer/middlewares"
+)
 
 func (a *application) get(s string, h http.HandlerFunc) {
 	a.App.Routes.Get(s, h)
@@ -10,6 +16,28 @@ func (a *application) post(s string, h http.HandlerFunc) {
 	a.App.Routes.Post(s, h)
 }
 
+// handle adapts a handler that returns its errors, see handlers.Handle
+func (a *application) handle(h handlers.HandlerFunc) http.HandlerFunc {
+	return a.Handlers.Handle(h)
+}
+
+// rateLimit limits the requests of each key to perMinute under the policy
+// name; it lets everything through when perMinute is 0 or rate limiting is
+// off
+func (a *application) rateLimit(name string, perMinute int, algorithm middlewares.RateLimitAlgorithm, key func(*http.Request) string) func(http.Handler) http.Handler {
+	if !a.Config.RateLimit.Enabled || perMinute == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	policy := middlewares.RateLimitPolicy{
+		Name:      name,
+		Limit:     perMinute,
+		Period:    time.Minute,
+		Algorithm: algorithm,
+		Key:       key,
+	}
+	return a.Middleware.RateLimit(a.RateLimits, policy, http.HandlerFunc(a.Handlers.TooManyRequests))
+}
+
 func (a *application) use(m ...func(http.Handler) http.Handler) {
 	a.App.Routes.Use(m...)
 }
@@ -0,0 +1,226 @@
+package data
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	up "github.com/upper/db/v4"
+)
+
+// Fields tagged encrypt:"true" are stored as AES-GCM ciphertexts and
+// decrypted when read. A field tagged encrypt:"index" is also written to a
+// keyed blind index, in the field whose db column is the field's column with
+// an _index suffix, so exact matches can still be looked up with blindCond.
+//
+// Ciphertexts look like enc:v1:<key id>:<base64 nonce and sealed text>, so
+// values written under a previous key stay readable while Reencrypt moves
+// them to the current one. Values without the prefix are read as plaintext,
+// which lets rows written before encryption was enabled be migrated in place.
+const ciphertextPrefix = "enc:v1:"
+
+var ErrUnknownKey = errors.New("value was encrypted with a key that is not configured")
+
+// fieldKey is one configured KEY, with the keys derived from it
+type fieldKey struct {
+	id    string
+	aead  cipher.AEAD
+	index []byte
+}
+
+// keys holds the current key first, then the previous ones; empty when
+// encryption is off
+var keys []*fieldKey
+
+// SetKeys enables field encryption with current, keeping previous keys to
+// read and look up values written before a rotation. With an empty current
+// key, encryption is turned off.
+func SetKeys(current string, previous ...string) error {
+	if current == "" {
+		keys = nil
+		return nil
+	}
+	var ks []*fieldKey
+	for _, k := range append([]string{current}, previous...) {
+		fk, err := newFieldKey(k)
+		if err != nil {
+			return err
+		}
+		ks = append(ks, fk)
+	}
+	keys = ks
+	return nil
+}
+
+func newFieldKey(key string) (*fieldKey, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption keys must be 32 characters, got %d", len(key))
+	}
+	// separate keys for each purpose, so the blind index reveals nothing
+	// about the encryption key
+	block, err := aes.NewCipher(derive(key, "field-encryption"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &fieldKey{
+		id:    hex.EncodeToString(derive(key, "key-id")[:4]),
+		aead:  aead,
+		index: derive(key, "blind-index"),
+	}, nil
+}
+
+func derive(key, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func encryptValue(plainText string) (string, error) {
+	if len(keys) == 0 || plainText == "" {
+		return plainText, nil
+	}
+	k := keys[0]
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := k.aead.Seal(nonce, nonce, []byte(plainText), []byte(k.id))
+	return ciphertextPrefix + k.id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptValue(value string) (string, error) {
+	if !strings.HasPrefix(value, ciphertextPrefix) {
+		return value, nil
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, ciphertextPrefix), ":")
+	if !ok {
+		return "", errors.New("malformed ciphertext")
+	}
+	for _, k := range keys {
+		if k.id != id {
+			continue
+		}
+		sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+		if err != nil || len(sealed) < k.aead.NonceSize() {
+			return "", errors.New("malformed ciphertext")
+		}
+		nonce := sealed[:k.aead.NonceSize()]
+		plainText, err := k.aead.Open(nil, nonce, sealed[k.aead.NonceSize():], []byte(id))
+		if err != nil {
+			return "", fmt.Errorf("decrypting value: %w", err)
+		}
+		return string(plainText), nil
+	}
+	return "", ErrUnknownKey
+}
+
+// blindIndex is the index of value under k; values are compared case
+// insensitively, since they are used for emails
+func blindIndex(k *fieldKey, value string) string {
+	mac := hmac.New(sha256.New, k.index)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// blindIndexes returns the index of value under every configured key
+func blindIndexes(value string) []string {
+	indexes := make([]string, len(keys))
+	for i, k := range keys {
+		indexes[i] = blindIndex(k, value)
+	}
+	return indexes
+}
+
+// blindCond matches rows whose column equals value. With encryption on it
+// compares the blind index under every configured key, so rows not yet
+// re-encrypted after a rotation are still found, and the plain column of the
+// rows without an index, written before encryption was enabled, until keys
+// rotate encrypts them.
+func blindCond(column, value string) up.LogicalExpr {
+	if len(keys) == 0 {
+		return up.Cond{column + " =": value}
+	}
+	return up.Or(
+		up.Cond{column + "_index IN": blindIndexes(value)},
+		up.Cond{column + "_index IS": nil, column + " =": value},
+	)
+}
+
+// encryptFields encrypts the tagged fields of item, which must point to a
+// struct, and fills in their blind indexes
+func encryptFields(item interface{}) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	v := reflect.ValueOf(item).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		tag := f.Tag.Get("encrypt")
+		if tag == "" || f.Type.Kind() != reflect.String {
+			continue
+		}
+		plainText := v.Field(i).String()
+		if tag == "index" {
+			index, ok := indexField(v, f)
+			if !ok {
+				return fmt.Errorf("%s.%s has no %s_index field", v.Type().Name(), f.Name, column(f))
+			}
+			if plainText != "" {
+				s := blindIndex(keys[0], plainText)
+				index.Set(reflect.ValueOf(&s))
+			}
+		}
+		cipherText, err := encryptValue(plainText)
+		if err != nil {
+			return err
+		}
+		v.Field(i).SetString(cipherText)
+	}
+	return nil
+}
+
+// decryptFields decrypts the tagged fields of item in place
+func decryptFields(item interface{}) error {
+	v := reflect.ValueOf(item).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.Tag.Get("encrypt") == "" || f.Type.Kind() != reflect.String {
+			continue
+		}
+		plainText, err := decryptValue(v.Field(i).String())
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", v.Type().Name(), f.Name, err)
+		}
+		v.Field(i).SetString(plainText)
+	}
+	return nil
+}
+
+// indexField returns the *string field holding the blind index of f
+func indexField(v reflect.Value, f reflect.StructField) (reflect.Value, bool) {
+	want := column(f) + "_index"
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if column(field) == want && field.Type == reflect.TypeOf((*string)(nil)) {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func column(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("db"), ",")
+	return name
+}
@@ -0,0 +1,91 @@
+package data
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	up "github.com/upper/db/v4"
+)
+
+const (
+	testKey      = "0123456789abcdef0123456789abcdef"
+	testKeyRenew = "fedcba9876543210fedcba9876543210"
+)
+
+func TestEncryptFields(t *testing.T) {
+	if err := SetKeys(testKey); err != nil {
+		t.Fatal(err)
+	}
+	defer SetKeys("")
+
+	u := User{FirstName: "Some", LastName: "Guy", Email: "Me@Here.com"}
+	if err := encryptFields(&u); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(u.FirstName, ciphertextPrefix) || !strings.HasPrefix(u.Email, ciphertextPrefix) {
+		t.Fatalf("expected ciphertexts, got %q and %q", u.FirstName, u.Email)
+	}
+	if u.EmailIndex == nil || *u.EmailIndex != blindIndex(keys[0], "me@here.com") {
+		t.Error("expected a case insensitive blind index of the email")
+	}
+
+	other := User{FirstName: "Some"}
+	_ = encryptFields(&other)
+	if other.FirstName == u.FirstName {
+		t.Error("expected equal values to encrypt differently")
+	}
+
+	if err := decryptFields(&u); err != nil {
+		t.Fatal(err)
+	}
+	if u.FirstName != "Some" || u.LastName != "Guy" || u.Email != "Me@Here.com" {
+		t.Errorf("expected the plain values back, got %+v", u)
+	}
+}
+
+func TestDecryptValue_Rotation(t *testing.T) {
+	if err := SetKeys(testKey); err != nil {
+		t.Fatal(err)
+	}
+	defer SetKeys("")
+	old, _ := encryptValue("secret")
+
+	// after a rotation the old key still reads, and lookups match both
+	_ = SetKeys(testKeyRenew, testKey)
+	if v, err := decryptValue(old); err != nil || v != "secret" {
+		t.Errorf("expected the previous key to decrypt, got %q %v", v, err)
+	}
+	if indexes := blindIndexes("me@here.com"); len(indexes) != 2 || indexes[0] == indexes[1] {
+		t.Errorf("expected a blind index per key, got %v", indexes)
+	}
+
+	_ = SetKeys(testKeyRenew)
+	if _, err := decryptValue(old); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey once the old key is gone, got %v", err)
+	}
+}
+
+func TestDecryptValue_Plaintext(t *testing.T) {
+	_ = SetKeys(testKey)
+	defer SetKeys("")
+	if v, err := decryptValue("me@here.com"); err != nil || v != "me@here.com" {
+		t.Errorf("expected values written before encryption to read as is, got %q %v", v, err)
+	}
+	if _, err := decryptValue(ciphertextPrefix + "nokey"); err == nil {
+		t.Error("expected a malformed ciphertext to fail")
+	}
+}
+
+func TestSetKeys(t *testing.T) {
+	defer SetKeys("")
+	if err := SetKeys("short"); err == nil {
+		t.Error("expected a short key to be refused")
+	}
+	if err := SetKeys(""); err != nil || len(keys) != 0 {
+		t.Error("expected an empty key to turn encryption off")
+	}
+	if cond := blindCond("email", "me@here.com").(up.Cond); cond["email ="] != "me@here.com" {
+		t.Errorf("expected a plain match without keys, got %v", cond)
+	}
+}
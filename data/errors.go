@@ -0,0 +1,123 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/mattn/go-sqlite3"
+	up "github.com/upper/db/v4"
+)
+
+var (
+	ErrNotFound       = errors.New("record not found")
+	ErrDuplicateEmail = errors.New("a user with that email address already exists")
+	ErrNoAuthHeader   = errors.New("no authorization header provided")
+	ErrTokenMalformed = errors.New("malformed authentication token")
+	ErrTokenExpired   = errors.New("token expired")
+	ErrInactiveUser   = errors.New("user is not active")
+)
+
+// ConstraintError is returned when a write violates a unique constraint
+// other than the one on users.email
+type ConstraintError struct {
+	Constraint string
+	Err        error
+}
+
+func (e *ConstraintError) Error() string {
+	return "unique constraint violated: " + e.Constraint
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	pgUniqueViolation    = "23505"
+	mysqlDuplicateEntry  = 1062
+	emailConstraintToken = "email"
+)
+
+// dbError translates errors coming from upper, pgx, the mysql and the sqlite drivers
+// into the domain errors of this package; anything else is returned as is
+func dbError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, up.ErrNoMoreRows) || errors.Is(err, up.ErrNilRecord) || errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return uniqueViolation(pgErr.ConstraintName, err)
+	}
+
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) && myErr.Number == mysqlDuplicateEntry {
+		// mysql only reports the key in the message: Duplicate entry 'x' for key 'email'
+		key := myErr.Message
+		if i := strings.LastIndex(key, "key "); i >= 0 {
+			key = strings.Trim(key[i+len("key "):], "'")
+		}
+		return uniqueViolation(key, err)
+	}
+
+	var liteErr sqlite3.Error
+	if errors.As(err, &liteErr) && liteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		// sqlite reports the columns: UNIQUE constraint failed: users.email
+		_, columns, _ := strings.Cut(liteErr.Error(), "failed: ")
+		return uniqueViolation(columns, err)
+	}
+
+	return err
+}
+
+func uniqueViolation(constraint string, err error) error {
+	if strings.Contains(constraint, emailConstraintToken) {
+		return ErrDuplicateEmail
+	}
+	return &ConstraintError{Constraint: constraint, Err: err}
+}
+
+// PublicMessage returns the message of the error of this package that err
+// wraps, without the context it was wrapped in, for a handler to show the
+// client. It is empty for the errors HTTPStatus maps to a server error.
+func PublicMessage(err error) string {
+	for _, known := range []error{ErrNotFound, ErrDuplicateEmail, ErrNoAuthHeader, ErrTokenMalformed, ErrTokenExpired, ErrInactiveUser} {
+		if errors.Is(err, known) {
+			return known.Error()
+		}
+	}
+	var constraintErr *ConstraintError
+	if errors.As(err, &constraintErr) {
+		// the constraint names the schema, which is none of the client's business
+		return "the record conflicts with an existing one"
+	}
+	return ""
+}
+
+// HTTPStatus maps an error returned by this package to the http status code
+// a handler should respond with
+func HTTPStatus(err error) int {
+	var constraintErr *ConstraintError
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrDuplicateEmail), errors.As(err, &constraintErr):
+		return http.StatusConflict
+	case errors.Is(err, ErrNoAuthHeader), errors.Is(err, ErrTokenMalformed), errors.Is(err, ErrTokenExpired):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrInactiveUser):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
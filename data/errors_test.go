@@ -0,0 +1,70 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	up "github.com/upper/db/v4"
+)
+
+var dbErrorTests = []struct {
+	name     string
+	err      error
+	expected error
+}{
+	{"nil", nil, nil},
+	{"no_more_rows", up.ErrNoMoreRows, ErrNotFound},
+	{"nil_record", fmt.Errorf("wrapped: %w", up.ErrNilRecord), ErrNotFound},
+	{"pg_email", &pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"}, ErrDuplicateEmail},
+	{"mysql_email", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'me@here.com' for key 'email'"}, ErrDuplicateEmail},
+}
+
+func TestDBError(t *testing.T) {
+	for _, tt := range dbErrorTests {
+		err := dbError(tt.err)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, err)
+		}
+	}
+
+	pgErr := &pgconn.PgError{Code: "23505", ConstraintName: "tokens_token_key"}
+	var constraintErr *ConstraintError
+	if !errors.As(dbError(pgErr), &constraintErr) {
+		t.Fatalf("expected ConstraintError, got %T", dbError(pgErr))
+	}
+	if constraintErr.Constraint != "tokens_token_key" {
+		t.Errorf("expected tokens_token_key, got %s", constraintErr.Constraint)
+	}
+
+	other := errors.New("connection refused")
+	if dbError(other) != other {
+		t.Error("unknown errors should be returned unchanged")
+	}
+}
+
+var statusTests = []struct {
+	err    error
+	status int
+}{
+	{nil, http.StatusOK},
+	{ErrNotFound, http.StatusNotFound},
+	{ErrDuplicateEmail, http.StatusConflict},
+	{&ConstraintError{Constraint: "x"}, http.StatusConflict},
+	{ErrNoAuthHeader, http.StatusUnauthorized},
+	{ErrTokenMalformed, http.StatusUnauthorized},
+	{fmt.Errorf("auth: %w", ErrTokenExpired), http.StatusUnauthorized},
+	{ErrInactiveUser, http.StatusForbidden},
+	{errors.New("boom"), http.StatusInternalServerError},
+}
+
+func TestHTTPStatus(t *testing.T) {
+	for _, tt := range statusTests {
+		if s := HTTPStatus(tt.err); s != tt.status {
+			t.Errorf("%v: expected %d, got %d", tt.err, tt.status, s)
+		}
+	}
+}
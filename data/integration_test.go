@@ -4,17 +4,23 @@
 package data
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
+	"github.com/prateekjoshi2013/scotch-primer/migrations"
+	up "github.com/upper/db/v4"
 )
 
 var (
@@ -40,8 +46,12 @@ var resource *dockertest.Resource
 var pool *dockertest.Pool
 
 func TestMain(m *testing.M) {
-	os.Setenv("DATABASE_TYPE", "postgres")
 	os.Setenv("UPPER_DB_LOG", "ERROR")
+	// DATABASE_TYPE=sqlite runs the suite against a temporary file instead of docker
+	if os.Getenv("DATABASE_TYPE") == "sqlite" {
+		os.Exit(runSQLite(m))
+	}
+	os.Setenv("DATABASE_TYPE", "postgres")
 	p, err := dockertest.NewPool("")
 	if err != nil {
 		log.Fatalf("Could not connect to docker: %s", err)
@@ -94,76 +104,35 @@ func TestMain(m *testing.M) {
 	}()
 }
 
+func runSQLite(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "scotch-app-test")
+	if err != nil {
+		log.Fatalf("Could not create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testDB, err = OpenSQLite(filepath.Join(dir, dbName+".db"))
+	if err != nil {
+		log.Fatalf("Could not open sqlite: %s", err)
+	}
+	defer testDB.Close()
+
+	err = createTables(testDB)
+	if err != nil {
+		log.Fatalf("Could not create tables: %s", err)
+	}
+
+	models = New(testDB)
+	return m.Run()
+}
+
 func createTables(db *sql.DB) error {
-	stmt := `
-	
-	CREATE OR REPLACE FUNCTION trigger_set_timestamp()
-		RETURNS TRIGGER AS $$
-	BEGIN
-		NEW.updated_at = NOW();
-		RETURN NEW;
-	END;
-	$$ LANGUAGE plpgsql;
-
-	drop table if exists users cascade;
-
-	CREATE TABLE users (
-		id SERIAL PRIMARY KEY,
-		first_name character varying(255) NOT NULL,
-		last_name character varying(255) NOT NULL,
-		user_active integer NOT NULL DEFAULT 0,
-		email character varying(255) NOT NULL UNIQUE,
-		password character varying(60) NOT NULL,
-		created_at timestamp without time zone NOT NULL DEFAULT now(),
-		updated_at timestamp without time zone NOT NULL DEFAULT now()
-	);
-
-	CREATE TRIGGER set_timestamp
-		BEFORE UPDATE ON users
-		FOR EACH ROW
-		EXECUTE PROCEDURE trigger_set_timestamp();
-
-	drop table if exists remember_tokens;
-
-	CREATE TABLE remember_tokens (
-		id SERIAL PRIMARY KEY,
-		user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE,
-		remember_token character varying(100) NOT NULL,
-		created_at timestamp without time zone NOT NULL DEFAULT now(),
-		updated_at timestamp without time zone NOT NULL DEFAULT now()
-	);
-
-	CREATE TRIGGER set_timestamp
-		BEFORE UPDATE ON remember_tokens
-		FOR EACH ROW
-		EXECUTE PROCEDURE trigger_set_timestamp();
-
-	drop table if exists tokens;
-
-	CREATE TABLE tokens (
-		id SERIAL PRIMARY KEY,
-		user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE,
-		first_name character varying(255) NOT NULL,
-		email character varying(255) NOT NULL,
-		token character varying(255) NOT NULL,
-		token_hash bytea NOT NULL,
-		created_at timestamp without time zone NOT NULL DEFAULT now(),
-		updated_at timestamp without time zone NOT NULL DEFAULT now(),
-		expiry timestamp without time zone NOT NULL
-	);
-
-	CREATE TRIGGER set_timestamp
-		BEFORE UPDATE ON tokens
-		FOR EACH ROW
-		EXECUTE PROCEDURE trigger_set_timestamp();
-
-
-	`
-	_, err := db.Exec(stmt)
+	runner, err := migrations.New(db, os.Getenv("DATABASE_TYPE"))
 	if err != nil {
 		return err
 	}
-	return nil
+	_, err = runner.Up()
+	return err
 }
 
 func TestUser_Table(t *testing.T) {
@@ -264,8 +233,18 @@ func TestUser_Delete(t *testing.T) {
 		t.Error("failed to delete user", err)
 	}
 	_, err = models.Users.Get(1)
-	if err == nil {
-		t.Error("failed to delete user")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	// the row stays, with the email taken, until it is purged
+	n, err := models.Users.PurgeDeleted(context.Background(), time.Now().Add(-time.Hour))
+	if err != nil || n != 0 {
+		t.Errorf("expected a recently deleted user to be kept, purged %d: %v", n, err)
+	}
+	n, err = models.Users.PurgeDeleted(context.Background(), time.Now().Add(time.Second))
+	if err != nil || n != 1 {
+		t.Errorf("expected the deleted user to be purged, purged %d: %v", n, err)
 	}
 }
 
@@ -509,3 +488,210 @@ func TestToken_ValidateToken(t *testing.T) {
 		t.Error("invalid token reported as valid")
 	}
 }
+
+func TestRepository_Paginate(t *testing.T) {
+	var repo Repository[User, *User]
+	for i := 0; i < 3; i++ {
+		u := dummyUser
+		u.Email = fmt.Sprintf("page%d@here.com", i)
+		_, err := models.Users.Insert(u)
+		if err != nil {
+			t.Fatal("failed to insert user", err)
+		}
+	}
+
+	page, err := repo.Paginate(notDeleted, 2, 3, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 4 || page.Pages != 2 {
+		t.Errorf("expected 4 users on 2 pages, got %d on %d", page.Total, page.Pages)
+	}
+	if len(page.Items) != 1 {
+		t.Errorf("expected 1 user on the last page, got %d", len(page.Items))
+	}
+
+	page, err = repo.Paginate(up.Cond{"email": dummyUser.Email}, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 {
+		t.Errorf("expected 1 matching user, got %d", page.Total)
+	}
+}
+
+func TestRepository_Find(t *testing.T) {
+	var repo Repository[User, *User]
+	all, err := repo.Find(notDeleted, "-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 || all[0].ID < all[1].ID {
+		t.Errorf("expected 4 users newest first, got %d", len(all))
+	}
+
+	_, err = repo.FindOne(up.Cond{"email": "nobody@here.com"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestRepository_DeleteWhere(t *testing.T) {
+	var repo Repository[User, *User]
+	if err := repo.DeleteWhere(nil); err == nil {
+		t.Error("deleting without a condition should fail")
+	}
+	if err := repo.DeleteWhere(up.Cond{"email": "page0@here.com"}); err != nil {
+		t.Error(err)
+	}
+	_, err := repo.FindOne(up.Cond{"email": "page0@here.com"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	u := dummyUser
+	u.Email = "purge@here.com"
+	id, err := models.Users.Insert(u)
+	if err != nil {
+		t.Fatal("failed to insert user", err)
+	}
+	u.ID = id
+	expired, _ := models.Tokens.GenerateToken(id, -time.Hour)
+	if err := models.Tokens.Insert(*expired, u); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	n, err := models.Tokens.DeleteExpired(ctx, time.Now())
+	if err != nil || n < 1 {
+		t.Errorf("expected the expired token to be purged, got %d, %v", n, err)
+	}
+	if _, err := models.Tokens.GetByToken(expired.PlainText); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the token to be gone, got %v", err)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	_, err = rememberTokens.Insert(&RememberToken{UserID: id, RememberToken: "old", CreatedAt: old, UpdatedAt: old})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rememberTokens.Insert(&RememberToken{UserID: id, RememberToken: "new", CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = models.RememberTokens.DeleteCreatedBefore(ctx, time.Now().Add(-24*time.Hour))
+	if err != nil || n != 1 {
+		t.Errorf("expected only the old remember token to be purged, got %d, %v", n, err)
+	}
+
+	expiry, fresh := "'2000-01-01 00:00:00'", "'2100-01-01 00:00:00'"
+	if os.Getenv("DATABASE_TYPE") == "sqlite" {
+		expiry, fresh = "julianday("+expiry+")", "julianday("+fresh+")"
+	}
+	_, err = testDB.Exec("insert into sessions (token, data, expiry) values ('expired', '', " + expiry + "), ('fresh', '', " + fresh + ")")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = PurgeSessions(ctx)
+	if err != nil || n != 1 {
+		t.Errorf("expected only the expired session to be purged, got %d, %v", n, err)
+	}
+}
+
+func TestEncryption_RoundTrip(t *testing.T) {
+	if err := SetKeys(testKey); err != nil {
+		t.Fatal(err)
+	}
+	defer SetKeys("")
+
+	u := dummyUser
+	u.Email = "Secret@Here.com"
+	id, err := models.Users.Insert(u)
+	if err != nil {
+		t.Fatal("failed to insert user", err)
+	}
+
+	var stored string
+	if err := testDB.QueryRow("select email from users where id = " + fmt.Sprint(id)).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, ciphertextPrefix) {
+		t.Fatalf("expected the email to be stored encrypted, got %q", stored)
+	}
+
+	found, err := models.Users.GetByEmail("secret@here.com")
+	if err != nil {
+		t.Fatal("expected the blind index to find the user:", err)
+	}
+	if found.ID != id || found.Email != "Secret@Here.com" || found.FirstName != dummyUser.FirstName {
+		t.Errorf("expected the decrypted user, got %+v", found)
+	}
+
+	_, err = models.Users.Insert(u)
+	if !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("expected the blind index to reject a duplicate email, got %v", err)
+	}
+}
+
+func TestEncryption_FindsRowsWrittenBeforeIt(t *testing.T) {
+	u := dummyUser
+	u.Email = "before@here.com"
+	id, err := models.Users.Insert(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer models.Users.Delete(id)
+
+	_ = SetKeys(testKey)
+	defer SetKeys("")
+	found, err := models.Users.GetByEmail("before@here.com")
+	if err != nil || found.ID != id {
+		t.Fatalf("expected the user without a blind index to be found by its plain email, got %v", err)
+	}
+
+	if _, err := models.Reencrypt(); err != nil {
+		t.Fatal(err)
+	}
+	found, err = models.Users.GetByEmail("before@here.com")
+	if err != nil || found.ID != id || found.EmailIndex == nil {
+		t.Errorf("expected the user to be found by its blind index after keys rotate, got %v", err)
+	}
+}
+
+func TestEncryption_Rotate(t *testing.T) {
+	_ = SetKeys(testKey)
+	defer SetKeys("")
+
+	// rows from the previous test, and from before encryption was on, are
+	// rewritten under the new key
+	_ = SetKeys(testKeyRenew, testKey)
+	if _, err := models.Users.GetByEmail("secret@here.com"); err != nil {
+		t.Fatal("expected lookups to match the previous key's index:", err)
+	}
+	n, err := models.Reencrypt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Error("expected records to be rewritten")
+	}
+
+	_ = SetKeys(testKeyRenew)
+	u, err := models.Users.GetByEmail("secret@here.com")
+	if err != nil {
+		t.Fatal("expected the user to be found under the new key alone:", err)
+	}
+	if _, err := models.Users.GetByEmail(dummyUser.Email); err != nil {
+		t.Error("expected users written in plain text to be indexed by the rotation:", err)
+	}
+
+	var stored string
+	if err := testDB.QueryRow("select first_name from users where id = " + fmt.Sprint(u.ID)).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, ciphertextPrefix+keys[0].id+":") {
+		t.Errorf("expected the new key id in the ciphertext, got %q", stored)
+	}
+}
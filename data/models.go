@@ -6,32 +6,56 @@ import (
 	"os"
 
 	db2 "github.com/upper/db/v4"
-	_ "github.com/upper/db/v4/adapter/mysql"
+	"github.com/upper/db/v4/adapter/mysql"
 	"github.com/upper/db/v4/adapter/postgresql"
+	"github.com/upper/db/v4/adapter/sqlite"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 )
 
 var db *sql.DB
 var upper db2.Session
 
+// dbSystem is the db.system attribute of the spans of the repository calls
+var dbSystem = semconv.DBSystemPostgreSQL
+
 type Models struct {
 	// any models inserted here (and in the New function)
 	// are easily accessible through the enitire application
-	Users  User
-	Tokens Token
+	Users          User
+	Tokens         Token
+	RememberTokens RememberToken
 }
 
 func New(databasePool *sql.DB) Models {
 	db = databasePool
-	if os.Getenv("DATABASE_TYPE") == "mysql" || os.Getenv("DATABASE_TYPE") == "mariadb" {
-		// TODO: add support for other database types
-	} else {
+	switch os.Getenv("DATABASE_TYPE") {
+	case "mysql", "mariadb":
+		upper, _ = mysql.New(databasePool)
+		dbSystem = semconv.DBSystemMySQL
+	case "sqlite":
+		upper, _ = sqlite.New(databasePool)
+		dbSystem = semconv.DBSystemSqlite
+	default:
 		upper, _ = postgresql.New(databasePool)
+		dbSystem = semconv.DBSystemPostgreSQL
 	}
 
 	return Models{
-		Users:  User{},
-		Tokens: Token{},
+		Users:          User{},
+		Tokens:         Token{},
+		RememberTokens: RememberToken{},
+	}
+}
+
+// Reencrypt rewrites the encrypted fields of every model under the current
+// key, see Repository.Reencrypt
+func (m Models) Reencrypt() (int, error) {
+	n, err := users.Reencrypt(500)
+	if err != nil {
+		return n, err
 	}
+	t, err := tokens.Reencrypt(500)
+	return n + t, err
 }
 
 func getInsertID(i db2.ID) int {
@@ -0,0 +1,30 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	up "github.com/upper/db/v4"
+)
+
+// RememberToken keeps a user logged in across sessions through the
+// remember me cookie
+type RememberToken struct {
+	ID            int       `db:"id,omitempty"`
+	UserID        int       `db:"user_id"`
+	RememberToken string    `db:"remember_token"`
+	CreatedAt     time.Time `db:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at"`
+}
+
+func (t *RememberToken) Table() string {
+	return "remember_tokens"
+}
+
+var rememberTokens Repository[RememberToken, *RememberToken]
+
+// DeleteCreatedBefore deletes the remember tokens created before the given
+// time, whose cookies have expired, and returns how many there were
+func (t *RememberToken) DeleteCreatedBefore(ctx context.Context, before time.Time) (int, error) {
+	return rememberTokens.WithContext(ctx).Purge(up.Cond{"created_at <": before})
+}
@@ -0,0 +1,314 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/prateekjoshi2013/scotch-primer/logging"
+	"github.com/prateekjoshi2013/scotch-primer/tracing"
+	up "github.com/upper/db/v4"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tabler is implemented by every model; PT is the pointer to the model
+// type, since the models declare Table on their pointer receiver
+type Tabler[T any] interface {
+	*T
+	Table() string
+}
+
+// Repository implements the crud operations shared by all models, e.g.
+// Repository[User, *User]{}. The zero value is ready to use; WithContext
+// returns one whose queries are cancelled with, logged through and traced
+// as children of a context.
+type Repository[T any, PT Tabler[T]] struct {
+	ctx context.Context
+}
+
+// Page is one page of results returned by Repository.Paginate
+type Page[T any] struct {
+	Items   []*T   `json:"items"`
+	Page    uint   `json:"page"`
+	PerPage uint   `json:"per_page"`
+	Pages   uint   `json:"pages"`
+	Total   uint64 `json:"total"`
+}
+
+func (r Repository[T, PT]) Table() string {
+	return PT(new(T)).Table()
+}
+
+// WithContext returns a copy of r that runs its queries with ctx, logs
+// through the logger stored in it and records spans under its span
+func (r Repository[T, PT]) WithContext(ctx context.Context) Repository[T, PT] {
+	r.ctx = ctx
+	return r
+}
+
+func (r Repository[T, PT]) session() up.Session {
+	if r.ctx != nil {
+		return upper.WithContext(r.ctx)
+	}
+	return upper
+}
+
+func (r Repository[T, PT]) collection() up.Collection {
+	return r.session().Collection(r.Table())
+}
+
+// call is a single repository operation, timed and traced by begin and done
+type call struct {
+	op    string
+	start time.Time
+	span  trace.Span
+}
+
+// begin starts the span of op, named after the sql operation and table, and
+// returns a copy of r whose queries run within it
+func (r Repository[T, PT]) begin(op, sqlOperation string) (Repository[T, PT], *call) {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := tracing.Tracer().Start(ctx, sqlOperation+" "+r.Table(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			dbSystem,
+			semconv.DBOperation(sqlOperation),
+			semconv.DBSQLTable(r.Table()),
+		))
+	r.ctx = ctx
+	return r, &call{op: op, start: time.Now(), span: span}
+}
+
+// statement records the sql of res on the span of c
+func (c *call) statement(res up.Result) up.Result {
+	c.span.SetAttributes(semconv.DBStatement(res.String()))
+	return res
+}
+
+// done ends the span of c, logs how long it took and converts err with
+// dbError. Errors callers are expected to handle, like a missing record, are
+// only logged at debug and don't mark the span as failed.
+func (r Repository[T, PT]) done(c *call, err error) error {
+	err = dbError(err)
+	level := slog.LevelDebug
+	if err != nil && HTTPStatus(err) == http.StatusInternalServerError {
+		level = slog.LevelError
+		tracing.End(c.span, err)
+	} else {
+		c.span.End()
+	}
+
+	logger := logging.FromContext(r.ctx)
+	if !logger.Enabled(r.ctx, level) {
+		return err
+	}
+	attrs := []any{
+		"table", r.Table(),
+		"op", c.op,
+		"duration_ms", float64(time.Since(c.start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	logger.Log(r.ctx, level, "db", attrs...)
+	return err
+}
+
+func (r Repository[T, PT]) find(cond up.LogicalExpr) up.Result {
+	if cond == nil || cond.Empty() {
+		return r.collection().Find()
+	}
+	return r.collection().Find(cond)
+}
+
+func (r Repository[T, PT]) Get(id int) (*T, error) {
+	r, c := r.begin("get", "SELECT")
+	var item T
+	err := c.statement(r.collection().Find(up.Cond{"id =": id})).One(&item)
+	if err == nil {
+		err = decryptFields(&item)
+	}
+	if err = r.done(c, err); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// FindOne returns the first record matching cond, in orderBy order if given
+func (r Repository[T, PT]) FindOne(cond up.LogicalExpr, orderBy ...interface{}) (*T, error) {
+	r, c := r.begin("find_one", "SELECT")
+	var item T
+	res := r.find(cond)
+	if len(orderBy) > 0 {
+		res = res.OrderBy(orderBy...)
+	}
+	err := c.statement(res).One(&item)
+	if err == nil {
+		err = decryptFields(&item)
+	}
+	if err = r.done(c, err); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// Find returns every record matching cond; a nil cond matches all records
+func (r Repository[T, PT]) Find(cond up.LogicalExpr, orderBy ...interface{}) ([]*T, error) {
+	r, c := r.begin("find", "SELECT")
+	var items []*T
+	res := r.find(cond)
+	if len(orderBy) > 0 {
+		res = res.OrderBy(orderBy...)
+	}
+	err := c.statement(res).All(&items)
+	if err == nil {
+		err = decryptAll(items)
+	}
+	if err = r.done(c, err); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Paginate returns the given page, starting at 1, of the records matching cond
+func (r Repository[T, PT]) Paginate(cond up.LogicalExpr, page, perPage uint, orderBy ...interface{}) (*Page[T], error) {
+	r, c := r.begin("paginate", "SELECT")
+	if page < 1 {
+		page = 1
+	}
+	res := r.find(cond)
+	if len(orderBy) > 0 {
+		res = res.OrderBy(orderBy...)
+	}
+	res = res.Paginate(perPage)
+
+	p := &Page[T]{Page: page, PerPage: perPage}
+	var err error
+	p.Total, err = res.TotalEntries()
+	if err != nil {
+		return nil, r.done(c, err)
+	}
+	p.Pages, err = res.TotalPages()
+	if err != nil {
+		return nil, r.done(c, err)
+	}
+	err = c.statement(res.Page(page)).All(&p.Items)
+	if err == nil {
+		err = decryptAll(p.Items)
+	}
+	if err = r.done(c, err); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Insert adds item and returns the id it was given. Encrypted fields are
+// encrypted in the stored copy only; item keeps the plain values.
+func (r Repository[T, PT]) Insert(item *T) (int, error) {
+	r, c := r.begin("insert", "INSERT")
+	row := *item
+	if err := encryptFields(&row); err != nil {
+		return 0, r.done(c, err)
+	}
+	res, err := r.collection().Insert(&row)
+	if err = r.done(c, err); err != nil {
+		return 0, err
+	}
+	return getInsertID(res.ID()), nil
+}
+
+func (r Repository[T, PT]) Update(id int, item *T) error {
+	r, c := r.begin("update", "UPDATE")
+	row := *item
+	if err := encryptFields(&row); err != nil {
+		return r.done(c, err)
+	}
+	err := r.collection().Find(id).Update(&row)
+	return r.done(c, err)
+}
+
+func (r Repository[T, PT]) Delete(id int) error {
+	r, c := r.begin("delete", "DELETE")
+	err := r.collection().Find(id).Delete()
+	return r.done(c, err)
+}
+
+// DeleteWhere deletes every record matching cond; an empty cond is refused
+// rather than emptying the table
+func (r Repository[T, PT]) DeleteWhere(cond up.Cond) error {
+	if len(cond) == 0 {
+		return errors.New("delete from " + r.Table() + " without a condition")
+	}
+	r, c := r.begin("delete_where", "DELETE")
+	err := r.find(cond).Delete()
+	return r.done(c, err)
+}
+
+// Purge deletes every record matching cond, like DeleteWhere, and returns
+// how many were deleted
+func (r Repository[T, PT]) Purge(cond up.Cond) (int, error) {
+	if len(cond) == 0 {
+		return 0, errors.New("purge of " + r.Table() + " without a condition")
+	}
+	r, c := r.begin("purge", "DELETE")
+	q := r.session().SQL().DeleteFrom(r.Table()).Where(cond)
+	c.span.SetAttributes(semconv.DBStatement(q.String()))
+	res, err := q.Exec()
+	n := 0
+	if err == nil {
+		var affected int64
+		affected, err = res.RowsAffected()
+		n = int(affected)
+	}
+	return n, r.done(c, err)
+}
+
+// Reencrypt rewrites every record, so that its encrypted fields are under the
+// current key and its blind indexes are filled in. Run it after rotating KEY,
+// or after enabling encryption on a table that holds plain values. It returns
+// the number of records rewritten.
+func (r Repository[T, PT]) Reencrypt(perPage uint) (int, error) {
+	n := 0
+	for page := uint(1); ; page++ {
+		p, err := r.Paginate(nil, page, perPage, "id")
+		if err != nil {
+			return n, err
+		}
+		for _, item := range p.Items {
+			if err := r.Update(recordID(item), item); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if page >= p.Pages {
+			return n, nil
+		}
+	}
+}
+
+func decryptAll[T any](items []*T) error {
+	for _, item := range items {
+		if err := decryptFields(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordID returns the value of the id column of item
+func recordID(item interface{}) int {
+	v := reflect.ValueOf(item).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if column(v.Type().Field(i)) == "id" {
+			return int(v.Field(i).Int())
+		}
+	}
+	return 0
+}
@@ -0,0 +1,32 @@
+package data
+
+import (
+	"context"
+
+	up "github.com/upper/db/v4"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// session is a row of the sessions table of the scs database stores
+type session struct{}
+
+func (s *session) Table() string {
+	return "sessions"
+}
+
+var sessions Repository[session, *session]
+
+// PurgeSessions deletes the expired sessions kept in the database and returns
+// how many there were. Expiry is compared with the database clock, in the
+// format each scs store writes it.
+func PurgeSessions(ctx context.Context) (int, error) {
+	now := up.Raw("now()")
+	switch dbSystem {
+	case semconv.DBSystemMySQL:
+		now = up.Raw("UTC_TIMESTAMP(6)")
+	case semconv.DBSystemSqlite:
+		// sqlite3store keeps julian days
+		now = up.Raw("julianday('now')")
+	}
+	return sessions.WithContext(ctx).Purge(up.Cond{"expiry <": now})
+}
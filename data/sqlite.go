@@ -0,0 +1,30 @@
+package data
+
+import (
+	"database/sql"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// OpenSQLite opens the sqlite database stored in the file at path, creating
+// it if needed. Foreign keys are switched on so that deleting a user
+// cascades to its tokens, as it does on postgres and mysql.
+func OpenSQLite(path string) (*sql.DB, error) {
+	dsn := "file:" + path
+	if strings.Contains(dsn, "?") {
+		dsn += "&_foreign_keys=on"
+	} else {
+		dsn += "?_foreign_keys=on"
+	}
+	pool, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite allows a single writer; one connection avoids "database is locked"
+	pool.SetMaxOpenConns(1)
+	if err := pool.Ping(); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
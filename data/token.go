@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base32"
@@ -9,14 +10,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/prateekjoshi2013/scotch-primer/logging"
+	"github.com/prateekjoshi2013/scotch-primer/metrics"
 	up "github.com/upper/db/v4"
 )
 
 type Token struct {
 	ID        int       `db:"id,omitempty" json:"id"`
 	UserID    int       `db:"user_id" json:"user_id"`
-	FirstName string    `db:"first_name" json:"first_name"`
-	Email     string    `db:"email" json:"email"`
+	FirstName string    `db:"first_name" json:"first_name" encrypt:"true"`
+	Email     string    `db:"email" json:"email" encrypt:"true"`
 	PlainText string    `db:"token" json:"token"`
 	Hash      []byte    `db:"token_hash" json:"-"`
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
@@ -28,80 +31,54 @@ func (t *Token) Table() string {
 	return "tokens"
 }
 
+var tokens Repository[Token, *Token]
+
 func (t *Token) GetUserForToken(token string) (*User, error) {
-	var theUser User
-	var theToken Token
+	return t.getUserForToken(context.Background(), token)
+}
 
-	collection := upper.Collection(t.Table())
-	err := collection.Find(up.Cond{"token": token}).One(&theToken)
+func (t *Token) getUserForToken(ctx context.Context, token string) (*User, error) {
+	theToken, err := tokens.WithContext(ctx).FindOne(up.Cond{"token": token})
 	if err != nil {
 		return nil, err
 	}
-	collection = upper.Collection(theUser.Table())
-	err = collection.Find(up.Cond{"id =": theToken.UserID}).One(&theUser)
+	theUser, err := users.WithContext(ctx).FindOne(up.And(up.Cond{"id": theToken.UserID}, notDeleted))
 	if err != nil {
 		return nil, err
 	}
-	theUser.Token = theToken
-	return &theUser, nil
+	theUser.Token = *theToken
+	return theUser, nil
 }
 
 func (t *Token) GetTokensForUser(id int) ([]*Token, error) {
-	var tokens []*Token
-	collection := upper.Collection(t.Table())
-	err := collection.Find(up.Cond{"user_id": id}).All(&tokens)
-	if err != nil {
-		return nil, err
-	}
-	return tokens, nil
+	return tokens.Find(up.Cond{"user_id": id})
 }
 
 func (t *Token) Get(id int) (*Token, error) {
-	var theToken Token
-	collection := upper.Collection(t.Table())
-	err := collection.Find(up.Cond{"id =": id}).One(&theToken)
-	if err != nil {
-		return nil, err
-	}
-	return &theToken, nil
+	return tokens.Get(id)
 }
 
 func (t *Token) GetByToken(plainText string) (*Token, error) {
-	var theToken Token
-	collection := upper.Collection(t.Table())
-	err := collection.Find(up.Cond{"token": plainText}).One(&theToken)
-	if err != nil {
-		return nil, err
-	}
-	return &theToken, nil
+	return tokens.FindOne(up.Cond{"token": plainText})
 }
 
 func (t *Token) Delete(id int) error {
-	collection := upper.Collection(t.Table())
-	res := collection.Find(id)
-	err := res.Delete()
-	if err != nil {
-		return err
-	}
-	return nil
+	return tokens.Delete(id)
 }
 
 func (t *Token) DeleteByToken(plainText string) error {
-	collection := upper.Collection(t.Table())
-	res := collection.Find(up.Cond{"token": plainText})
-	err := res.Delete()
-	if err != nil {
-		return err
-	}
-	return nil
+	return tokens.DeleteWhere(up.Cond{"token": plainText})
 }
 
-func (t *Token) Insert(theToken Token, u User) error {
-	collection := upper.Collection(t.Table())
+// DeleteExpired deletes the tokens that expired before the given time and
+// returns how many there were
+func (t *Token) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	return tokens.WithContext(ctx).Purge(up.Cond{"expiry <": before})
+}
 
+func (t *Token) Insert(theToken Token, u User) error {
 	// delete existing tokens
-	res := collection.Find(up.Cond{"user_id =": u.ID})
-	err := res.Delete()
+	err := tokens.DeleteWhere(up.Cond{"user_id =": u.ID})
 	if err != nil {
 		return err
 	}
@@ -110,11 +87,8 @@ func (t *Token) Insert(theToken Token, u User) error {
 	theToken.FirstName = u.FirstName
 	theToken.Email = u.Email
 
-	_, err = collection.Insert(theToken)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err = tokens.Insert(&theToken)
+	return err
 }
 
 func (t *Token) GenerateToken(userID int, ttl time.Duration) (*Token, error) {
@@ -134,31 +108,58 @@ func (t *Token) GenerateToken(userID int, ttl time.Duration) (*Token, error) {
 }
 
 func (t *Token) Authenticate(r *http.Request) (*User, error) {
+	user, err := t.authenticate(r)
+	outcome := authOutcome(err)
+	metrics.TokenAuthentications.WithLabelValues(outcome).Inc()
+	logging.FromContext(r.Context()).Debug("token authentication", "outcome", outcome)
+	return user, err
+}
+
+// authOutcome is the metrics label for the result of an authentication
+func authOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, ErrNoAuthHeader):
+		return "no_header"
+	case errors.Is(err, ErrTokenMalformed):
+		return "malformed"
+	case errors.Is(err, ErrNotFound):
+		return "unknown_token"
+	case errors.Is(err, ErrTokenExpired):
+		return "expired"
+	case errors.Is(err, ErrInactiveUser):
+		return "inactive"
+	default:
+		return "error"
+	}
+}
+
+func (t *Token) authenticate(r *http.Request) (*User, error) {
 	authorizationHeader := r.Header.Get("Authorization")
 	if authorizationHeader == "" {
-		return nil, errors.New("no authorization header provided")
+		return nil, ErrNoAuthHeader
 	}
 
 	headerParts := strings.Split(authorizationHeader, " ")
 	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-		return nil, errors.New("no authorization header provided")
+		return nil, ErrTokenMalformed
 	}
 
 	token := headerParts[1]
 	if len(token) != 26 {
-		return nil, errors.New("token wrong size")
+		return nil, ErrTokenMalformed
 	}
 
-	t, err := t.GetByToken(token)
+	user, err := t.getUserForToken(r.Context(), token)
 	if err != nil {
 		return nil, err
 	}
-	if t.Expires.Before(time.Now()) {
-		return nil, errors.New("token expired")
+	if user.Token.Expires.Before(time.Now()) {
+		return nil, ErrTokenExpired
 	}
-	user, err := t.GetUserForToken(token)
-	if err != nil {
-		return nil, err
+	if user.Active == 0 {
+		return nil, ErrInactiveUser
 	}
 	return user, nil
 }
@@ -166,14 +167,14 @@ func (t *Token) Authenticate(r *http.Request) (*User, error) {
 func (t *Token) ValidToken(theToken string) (bool, error) {
 	user, err := t.GetUserForToken(theToken)
 	if err != nil {
-		return false, errors.New("no matching user found")
+		return false, err
 	}
 	if user.Token.PlainText == "" {
-		return false, errors.New("no matching token found")
+		return false, ErrNotFound
 	}
 
 	if user.Token.Expires.Before(time.Now()) {
-		return false, errors.New("token expired")
+		return false, ErrTokenExpired
 	}
 	return true, nil
 }
@@ -1,106 +1,127 @@
 package data
 
 import (
+	"context"
 	"errors"
+	"sort"
 	"time"
 
 	"github.com/prateekjoshi2013/scotch"
+	"github.com/prateekjoshi2013/scotch-primer/forms"
 
 	up "github.com/upper/db/v4"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
-	ID        int       `db:"id,omitempty"`
-	FirstName string    `db:"first_name"`
-	LastName  string    `db:"last_name"`
-	Email     string    `db:"email"`
-	Active    int       `db:"user_active"`
-	Password  string    `db:"password"`
-	CreatedAt time.Time `db:"created_at"`
-	UpdatedAt time.Time `db:"updated_at"`
-	Token     Token     `db:"-"`
+	ID        int    `db:"id,omitempty"`
+	FirstName string `db:"first_name" encrypt:"true" form:"first_name" validate:"required,min=2,max=255"`
+	LastName  string `db:"last_name" encrypt:"true" form:"last_name" validate:"required,min=2,max=255"`
+	Email     string `db:"email" encrypt:"index" form:"email" validate:"required,email,max=255"`
+	// EmailIndex is the blind index GetByEmail looks users up by; it is
+	// left empty while encryption is off
+	EmailIndex *string   `db:"email_index,omitempty" json:"-"`
+	Active     int       `db:"user_active"`
+	Password   string    `db:"password"`
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+	// DeletedAt is set by Delete; deleted users aren't found any more, and
+	// are purged for good later
+	DeletedAt *time.Time `db:"deleted_at,omitempty" json:"-"`
+	Token     Token      `db:"-"`
 }
 
 func (u *User) Table() string {
 	return "users"
 }
 
+// Validate checks the rules in the validate tags of the user
 func (u *User) Validate(validator *scotch.Validation) {
-	validator.Check(u.LastName != "", "last_name", "Last Name cannot be empty")
-	validator.Check(u.FirstName != "", "first_name", "Last Name cannot be empty")
-	validator.Check(u.Email != "", "email", "Email cannot be empty")
-	validator.IsEmail("email", u.Email)
+	forms.Validate(u, validator)
 }
 
+var users Repository[User, *User]
+
+// notDeleted is the condition every lookup of users adds
+var notDeleted = up.Cond{"deleted_at IS": nil}
+
 func (u *User) GetAll() ([]*User, error) {
-	collection := upper.Collection(u.Table())
-	var users []*User
-	err := collection.Find().OrderBy("last_name").All(&users)
+	all, err := users.Find(notDeleted)
 	if err != nil {
 		return nil, err
 	}
-	return users, nil
+	// encrypted names can't be sorted by the database
+	sort.SliceStable(all, func(i, j int) bool { return all[i].LastName < all[j].LastName })
+	return all, nil
 }
 
 func (u *User) GetByEmail(email string) (*User, error) {
-	var theUser User
-	collection := upper.Collection(u.Table())
-	err := collection.Find(up.Cond{"email =": email}).One(&theUser)
+	return u.GetByEmailContext(context.Background(), email)
+}
+
+// GetByEmailContext is GetByEmail with the queries bound to, and logged
+// through, ctx
+func (u *User) GetByEmailContext(ctx context.Context, email string) (*User, error) {
+	theUser, err := users.WithContext(ctx).FindOne(up.And(blindCond("email", email), notDeleted))
 	if err != nil {
 		return nil, err
 	}
-	var token Token
-	collection = upper.Collection(token.Table())
-	err = collection.Find(up.Cond{"user_id =": theUser.ID, "expiry >": time.Now()}).OrderBy("created_at desc").One(&token)
-	if err != nil {
-		if err != up.ErrNilRecord && err != up.ErrNoMoreRows {
-			return nil, err
-		}
-	}
-	theUser.Token = token
-	return &theUser, nil
+	return theUser.withToken(ctx)
 }
 
 func (u *User) Get(id int) (*User, error) {
-	var theUser User
-	collection := upper.Collection(u.Table())
-	err := collection.Find(up.Cond{"id =": id}).One(&theUser)
+	return u.GetContext(context.Background(), id)
+}
+
+// GetContext is Get with the queries bound to, and logged through, ctx
+func (u *User) GetContext(ctx context.Context, id int) (*User, error) {
+	theUser, err := users.WithContext(ctx).FindOne(up.And(up.Cond{"id": id}, notDeleted))
 	if err != nil {
 		return nil, err
 	}
-	var token Token
-	collection = upper.Collection(token.Table())
-	err = collection.Find(up.Cond{"user_id =": theUser.ID, "expiry >": time.Now()}).OrderBy("created_at desc").One(&token)
+	return theUser.withToken(ctx)
+}
+
+// withToken attaches the latest unexpired token of the user, if any
+func (u *User) withToken(ctx context.Context) (*User, error) {
+	token, err := tokens.WithContext(ctx).FindOne(up.Cond{"user_id =": u.ID, "expiry >": time.Now()}, "created_at desc")
 	if err != nil {
-		if err != up.ErrNilRecord && err != up.ErrNoMoreRows {
+		if !errors.Is(err, ErrNotFound) {
 			return nil, err
 		}
+		token = &Token{}
 	}
-	theUser.Token = token
-	return &theUser, nil
-
+	u.Token = *token
+	return u, nil
 }
 
 func (u *User) Update(theUser *User) error {
 	theUser.UpdatedAt = time.Now()
-	collection := upper.Collection(u.Table())
-	res := collection.Find(theUser.ID)
-	err := res.Update(theUser)
-	if err != nil {
-		return err
-	}
-	return nil
+	return users.Update(theUser.ID, theUser)
 }
 
+// Delete soft deletes the user: it isn't found any more and its tokens are
+// deleted at once, but its row, and so its email, stays until PurgeDeleted
 func (u *User) Delete(id int) error {
-	collection := upper.Collection(u.Table())
-	res := collection.Find(id)
-	err := res.Delete()
+	theUser, err := u.Get(id)
 	if err != nil {
 		return err
 	}
-	return nil
+	now := time.Now()
+	theUser.DeletedAt = &now
+	if err := u.Update(theUser); err != nil {
+		return err
+	}
+	if err := tokens.DeleteWhere(up.Cond{"user_id": id}); err != nil {
+		return err
+	}
+	return rememberTokens.DeleteWhere(up.Cond{"user_id": id})
+}
+
+// PurgeDeleted removes the users deleted before the given time, with
+// everything that references them, and returns how many there were
+func (u *User) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	return users.WithContext(ctx).Purge(up.Cond{"deleted_at <": before})
 }
 
 func (u *User) Insert(theUser User) (int, error) {
@@ -111,13 +132,7 @@ func (u *User) Insert(theUser User) (int, error) {
 	theUser.Password = string(newHash)
 	theUser.CreatedAt = time.Now()
 	theUser.UpdatedAt = time.Now()
-	collection := upper.Collection(u.Table())
-	res, err := collection.Insert(theUser)
-	if err != nil {
-		return 0, err
-	}
-	id := getInsertID(res.ID())
-	return id, nil
+	return users.Insert(&theUser)
 }
 
 func (u *User) ResetPassword(id int, password string) error {
@@ -129,12 +144,8 @@ func (u *User) ResetPassword(id int, password string) error {
 	if err != nil {
 		return err
 	}
-	u.Password = string(newHash)
-	err = theUser.Update(u)
-	if err != nil {
-		return err
-	}
-	return nil
+	theUser.Password = string(newHash)
+	return u.Update(theUser)
 }
 
 func (u *User) PasswordMatches(plainText string) (bool, error) {
@@ -0,0 +1,303 @@
+// Package forms binds request bodies into structs and validates them with
+// rules declared in struct tags.
+//
+// Only the fields with a form tag are bound, from the posted form or from
+// the key of the same name in a json body, so a client can't set fields the
+// form doesn't have. The validate tag holds comma separated rules, checked
+// in order until one fails:
+//
+//	required      the value is not blank
+//	email         the value is an email address
+//	min=n, max=n  the length of a string, or the value of a number
+//	matches=name  the value equals the field whose form tag is name
+//	regex=expr    the value matches expr; it takes the rest of the tag, so
+//	              it comes last and expr may contain commas
+//
+// The rules other than required pass on blank values. Failures are added to
+// a scotch.Validation under the form name of the field, the key the Jet
+// forms read validator.Errors with.
+package forms
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/prateekjoshi2013/scotch"
+)
+
+// ErrMalformed is returned for a body that can't be parsed at all, as
+// opposed to fields with invalid values
+var ErrMalformed = errors.New("malformed request body")
+
+// maxBodySize bounds the json bodies Decode reads
+const maxBodySize = 1 << 20
+
+// Decode binds the request body into dst, a pointer to a struct, and
+// validates it. Values that don't fit their field, and failed rules, are
+// added to v; only a body that can't be parsed is returned as an error.
+func Decode(r *http.Request, dst interface{}, v *scotch.Validation) error {
+	fields, err := structFields(dst)
+	if err != nil {
+		return err
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		err = bindJSON(r, fields, v)
+	} else {
+		err = bindForm(r, fields, v)
+	}
+	if err != nil {
+		return err
+	}
+	validate(fields, v)
+	return nil
+}
+
+// Validate checks the validate rules of src, a struct or a pointer to one,
+// and adds the failures to v
+func Validate(src interface{}, v *scotch.Validation) {
+	val := reflect.Indirect(reflect.ValueOf(src))
+	if val.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("forms: Validate needs a struct, got %T", src))
+	}
+	validate(collect(val), v)
+}
+
+type field struct {
+	name  string
+	rules string
+	value reflect.Value
+}
+
+func structFields(dst interface{}) ([]field, error) {
+	val := reflect.ValueOf(dst)
+	if val.Kind() != reflect.Pointer || val.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("forms: Decode needs a pointer to a struct, got %T", dst)
+	}
+	return collect(val.Elem()), nil
+}
+
+// collect returns the fields of val with a form tag
+func collect(val reflect.Value) []field {
+	var fields []field
+	t := val.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("form")
+		if name == "" || name == "-" || !f.IsExported() {
+			continue
+		}
+		fields = append(fields, field{name: name, rules: f.Tag.Get("validate"), value: val.Field(i)})
+	}
+	return fields
+}
+
+func bindForm(r *http.Request, fields []field, v *scotch.Validation) error {
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	for _, f := range fields {
+		values, ok := r.Form[f.name]
+		if !ok {
+			continue
+		}
+		if err := setString(f.value, values); err != nil {
+			v.AddError(f.name, err.Error())
+		}
+	}
+	return nil
+}
+
+func bindJSON(r *http.Request, fields []field, v *scotch.Validation) error {
+	body := make(map[string]json.RawMessage)
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	if err := dec.Decode(&body); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	for _, f := range fields {
+		raw, ok := body[f.name]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(raw, f.value.Addr().Interface()); err != nil {
+			v.AddError(f.name, "has the wrong type")
+		}
+	}
+	return nil
+}
+
+// setString sets dst from the posted values of its field
+func setString(dst reflect.Value, values []string) error {
+	if dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.String {
+		dst.Set(reflect.ValueOf(append([]string(nil), values...)))
+		return nil
+	}
+	s := ""
+	if len(values) > 0 {
+		s = strings.TrimSpace(values[0])
+	}
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(s)
+	case reflect.Bool:
+		// unchecked boxes are not posted at all
+		dst.SetBool(s != "" && s != "false" && s != "0" && s != "off")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s == "" {
+			dst.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, dst.Type().Bits())
+		if err != nil {
+			return errors.New("must be a whole number")
+		}
+		dst.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		if s == "" {
+			dst.SetFloat(0)
+			return nil
+		}
+		n, err := strconv.ParseFloat(s, dst.Type().Bits())
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		dst.SetFloat(n)
+	default:
+		panic(fmt.Sprintf("forms: can't bind a form value into a %s", dst.Type()))
+	}
+	return nil
+}
+
+func validate(fields []field, v *scotch.Validation) {
+	byName := make(map[string]reflect.Value, len(fields))
+	for _, f := range fields {
+		byName[f.name] = f.value
+	}
+	for _, f := range fields {
+		if f.rules == "" {
+			continue
+		}
+		if _, failed := v.Errors[f.name]; failed {
+			// the value didn't bind, there is nothing to check
+			continue
+		}
+		checkRules(f, byName, v)
+	}
+}
+
+func checkRules(f field, byName map[string]reflect.Value, v *scotch.Validation) {
+	blank := isBlank(f.value)
+	rules := f.rules
+	for rules != "" {
+		var rule string
+		if strings.HasPrefix(rules, "regex=") {
+			rule, rules = rules, ""
+		} else {
+			rule, rules, _ = strings.Cut(rules, ",")
+		}
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		if name == "required" {
+			if blank {
+				v.AddError(f.name, "This field cannot be blank")
+				return
+			}
+			continue
+		}
+		if blank {
+			return
+		}
+		if msg := check(name, arg, f, byName, v); msg != "" {
+			v.AddError(f.name, msg)
+			return
+		}
+		if _, failed := v.Errors[f.name]; failed {
+			return
+		}
+	}
+}
+
+// check runs one rule other than required, returning the message of its
+// failure
+func check(name, arg string, f field, byName map[string]reflect.Value, v *scotch.Validation) string {
+	switch name {
+	case "email":
+		v.IsEmail(f.name, f.value.String())
+	case "min", "max":
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			panic(fmt.Sprintf("forms: %s: invalid %s=%s", f.name, name, arg))
+		}
+		size, unit := measure(f.value)
+		switch {
+		case name == "min" && size < n:
+			return fmt.Sprintf("must be at least %s%s", arg, unit)
+		case name == "max" && size > n:
+			return fmt.Sprintf("must be at most %s%s", arg, unit)
+		}
+	case "matches":
+		other, ok := byName[arg]
+		if !ok {
+			panic(fmt.Sprintf("forms: %s: matches unknown field %s", f.name, arg))
+		}
+		if !reflect.DeepEqual(f.value.Interface(), other.Interface()) {
+			return "must match " + strings.ReplaceAll(arg, "_", " ")
+		}
+	case "regex":
+		if !compile(arg).MatchString(fmt.Sprint(f.value.Interface())) {
+			return "is not in the expected format"
+		}
+	default:
+		panic(fmt.Sprintf("forms: %s: unknown rule %q", f.name, name))
+	}
+	return ""
+}
+
+// measure returns what min and max compare: the length of strings and
+// slices, the value of numbers
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice:
+		return float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	}
+	panic(fmt.Sprintf("forms: min and max don't apply to a %s", v.Type()))
+}
+
+func isBlank(v reflect.Value) bool {
+	if v.Kind() == reflect.String {
+		return strings.TrimSpace(v.String()) == ""
+	}
+	if v.Kind() == reflect.Slice {
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+var patterns sync.Map
+
+// compile compiles the regex rules once; an invalid one is a programming
+// error
+func compile(expr string) *regexp.Regexp {
+	if re, ok := patterns.Load(expr); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(expr)
+	patterns.Store(expr, re)
+	return re
+}
@@ -0,0 +1,143 @@
+package forms
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prateekjoshi2013/scotch"
+)
+
+type signup struct {
+	Name     string   `form:"name" validate:"required,min=2,max=10"`
+	Email    string   `form:"email" validate:"required,email"`
+	Age      int      `form:"age" validate:"min=18"`
+	Password string   `form:"password" validate:"required,min=8"`
+	Confirm  string   `form:"confirm" validate:"matches=password"`
+	Code     string   `form:"code" validate:"regex=^[A-Z]{2,3}-\\d+$"`
+	Tags     []string `form:"tags" validate:"max=2"`
+	Admin    bool
+}
+
+func newValidation() *scotch.Validation {
+	return (&scotch.Scotch{}).Validator(nil)
+}
+
+func TestDecode_Form(t *testing.T) {
+	form := url.Values{
+		"name":     {" Ada "},
+		"email":    {"ada@example.com"},
+		"age":      {"36"},
+		"password": {"correct horse"},
+		"confirm":  {"correct horse"},
+		"code":     {"AB-12"},
+		"tags":     {"go", "sql"},
+		"Admin":    {"true"},
+	}
+	r := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var got signup
+	v := newValidation()
+	if err := Decode(r, &got, v); err != nil {
+		t.Fatal(err)
+	}
+	if !v.Valid() {
+		t.Fatalf("expected the form to be valid, got %v", v.Errors)
+	}
+	if got.Name != "Ada" || got.Age != 36 || len(got.Tags) != 2 || got.Confirm != got.Password {
+		t.Errorf("expected the values to be bound, got %+v", got)
+	}
+	if got.Admin {
+		t.Error("expected a field without a form tag not to be bound")
+	}
+}
+
+func TestDecode_FieldErrors(t *testing.T) {
+	form := url.Values{
+		"name":     {"A"},
+		"email":    {"not an email"},
+		"age":      {"old"},
+		"password": {"short"},
+		"confirm":  {"other"},
+		"code":     {"ab-12"},
+		"tags":     {"a", "b", "c"},
+	}
+	r := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	v := newValidation()
+	if err := Decode(r, &signup{}, v); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"name":     "must be at least 2 characters",
+		"email":    "Invalid email address",
+		"age":      "must be a whole number",
+		"password": "must be at least 8 characters",
+		"confirm":  "must match password",
+		"code":     "is not in the expected format",
+		"tags":     "must be at most 2 items",
+	}
+	for field, msg := range want {
+		if v.Errors[field] != msg {
+			t.Errorf("%s: expected %q, got %q", field, msg, v.Errors[field])
+		}
+	}
+	if len(v.Errors) != len(want) {
+		t.Errorf("expected %d errors, got %v", len(want), v.Errors)
+	}
+}
+
+func TestDecode_Required(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader("name=++&age=20"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	v := newValidation()
+	if err := Decode(r, &signup{}, v); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"name", "email", "password"} {
+		if v.Errors[field] != "This field cannot be blank" {
+			t.Errorf("%s: expected it to be required, got %q", field, v.Errors[field])
+		}
+	}
+	if _, ok := v.Errors["code"]; ok {
+		t.Error("expected the rules of a blank optional field to pass")
+	}
+}
+
+func TestDecode_JSON(t *testing.T) {
+	body := `{"name": "Ada", "email": "ada@example.com", "age": "36", "password": "correct horse",
+		"confirm": "correct horse", "Admin": true}`
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	var got signup
+	v := newValidation()
+	if err := Decode(r, &got, v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Errors["age"] != "has the wrong type" || len(v.Errors) != 1 {
+		t.Errorf("expected only the age to be refused, got %v", v.Errors)
+	}
+	if got.Name != "Ada" || got.Admin {
+		t.Errorf("expected only the form fields to be bound, got %+v", got)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader(`{"name": `))
+	r.Header.Set("Content-Type", "application/json")
+	if err := Decode(r, &got, newValidation()); !errors.Is(err, ErrMalformed) {
+		t.Errorf("expected ErrMalformed, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	v := newValidation()
+	Validate(signup{Name: "Ada", Email: "ada@example.com", Password: "correct horse", Confirm: "correct horse"}, v)
+	if !v.Valid() {
+		t.Errorf("expected the struct to be valid, got %v", v.Errors)
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/prateekjoshi2013/scotch-primer/data"
+	"github.com/prateekjoshi2013/scotch-primer/middlewares"
+)
+
+// userView is a user as pages and the api show it, without the password hash
+type userView struct {
+	ID        int    `json:"id,omitempty"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+}
+
+func newUserView(u *data.User) userView {
+	return userView{
+		ID:        u.ID,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Email:     u.Email,
+	}
+}
+
+// APIMe returns the user of the bearer token
+func (h *Handlers) APIMe(w http.ResponseWriter, r *http.Request) error {
+	user := middlewares.TokenUser(r.Context())
+	if user == nil {
+		return NewError(http.StatusUnauthorized, "invalid auth credentials", nil)
+	}
+	return h.App.WriteJSON(w, http.StatusOK, newUserView(user))
+}
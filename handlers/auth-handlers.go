@@ -1,45 +1,76 @@
 package handlers
 
-import "net/http"
+import (
+	"errors"
+	"net/http"
 
-func (h *Handlers) UserLogin(w http.ResponseWriter, r *http.Request) {
-	err := h.render(w, r, "login", nil, nil)
-	if err != nil {
-		h.App.ErrorLog.Println(err)
-	}
+	"github.com/prateekjoshi2013/scotch-primer/data"
+	"github.com/prateekjoshi2013/scotch-primer/metrics"
+)
 
+func (h *Handlers) UserLogin(w http.ResponseWriter, r *http.Request) error {
+	return h.render(w, r, "login", nil, nil)
 }
 
-func (h *Handlers) PostUserLogin(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) PostUserLogin(w http.ResponseWriter, r *http.Request) error {
 	err := r.ParseForm()
 	if err != nil {
-		w.Write([]byte(err.Error()))
-		return
+		return NewError(http.StatusBadRequest, "The form could not be read.", err)
 	}
 	email := r.Form.Get("email")
 	password := r.Form.Get("password")
 
-	user, err := h.Models.Users.GetByEmail(email)
+	user, err := h.Models.Users.GetByEmailContext(r.Context(), email)
 	if err != nil {
-		w.Write([]byte(err.Error()))
-		return
+		return h.loginFailed(w, r, err)
 	}
 	matches, err := user.PasswordMatches(password)
 	if err != nil {
-		w.Write([]byte("Error validating password"))
-		return
+		return h.loginFailed(w, r, err)
 	}
 	if !matches {
-		w.Write([]byte("Invalid password"))
-		return
+		return h.loginFailed(w, r, data.ErrNotFound)
+	}
+	if user.Active == 0 {
+		return h.loginFailed(w, r, data.ErrInactiveUser)
 	}
 
+	metrics.LoginAttempts.WithLabelValues("success").Inc()
 	h.App.Session.Put(r.Context(), "userID", user.ID)
+	h.logger(r).Info("user logged in")
+	h.Flash(r.Context(), FlashSuccess, "Welcome back, "+user.FirstName+"!")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
+	return nil
+}
+
+// loginFailed counts the failed login and sends the user back to the login
+// page with a flash message. An unknown email gets the same message as a
+// wrong password, so that the client can't tell them apart.
+func (h *Handlers) loginFailed(w http.ResponseWriter, r *http.Request, err error) error {
+	switch {
+	case errors.Is(err, data.ErrNotFound):
+		metrics.LoginAttempts.WithLabelValues("invalid_credentials").Inc()
+		h.Flash(r.Context(), FlashError, "Invalid credentials")
+	case data.HTTPStatus(err) == http.StatusInternalServerError:
+		metrics.LoginAttempts.WithLabelValues("error").Inc()
+		return err
+	default:
+		metrics.LoginAttempts.WithLabelValues("rejected").Inc()
+		h.logger(r).Info("login rejected", "reason", err)
+		message := "You can't log in with this account."
+		if errors.Is(err, data.ErrInactiveUser) {
+			message = "Your account is not active yet."
+		}
+		h.Flash(r.Context(), FlashWarning, message)
+	}
+	http.Redirect(w, r, "/users/login", http.StatusSeeOther)
+	return nil
 }
 
 func (h *Handlers) UserLogout(w http.ResponseWriter, r *http.Request) {
+	h.logger(r).Info("user logged out")
 	h.App.Session.RenewToken(r.Context())
 	h.App.Session.Remove(r.Context(), "userID")
+	h.Flash(r.Context(), FlashInfo, "You have been logged out.")
 	http.Redirect(w, r, "/users/login", http.StatusSeeOther)
 }
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/prateekjoshi2013/scotch"
+	"github.com/prateekjoshi2013/scotch-primer/data"
+	"github.com/prateekjoshi2013/scotch-primer/middlewares"
+	"github.com/prateekjoshi2013/scotch-primer/migrations"
+	"github.com/prateekjoshi2013/scotch/render"
+)
+
+// testLoginApp returns the login routes behind the csrf middleware, with the
+// views of the app and a sqlite database holding one user
+func testLoginApp(t *testing.T) http.Handler {
+	t.Helper()
+	t.Setenv("DATABASE_TYPE", "sqlite")
+	pool, err := data.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+	runner, err := migrations.New(pool, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Up(); err != nil {
+		t.Fatal(err)
+	}
+	models := data.New(pool)
+	if _, err := models.Users.Insert(data.User{FirstName: "Ada", LastName: "Lovelace",
+		Email: "ada@example.com", Active: 1, Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := scs.New()
+	h := &Handlers{
+		App:    &scotch.Scotch{Session: session, Render: &render.Render{Renderer: "jet", JetViews: testViews(t), Session: session}},
+		Models: models,
+	}
+	mux := chi.NewRouter()
+	mux.Use(session.LoadAndSave)
+	mux.Use((&middlewares.Middleware{}).CSRF(false, "", http.HandlerFunc(h.CSRFFailure)))
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Get("/users/login", h.Handle(h.UserLogin))
+	mux.Post("/users/login", h.Handle(h.PostUserLogin))
+	return mux
+}
+
+var (
+	csrfField = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+	csrfMeta  = regexp.MustCompile(`<meta name="csrf-token" content="([^"]+)">`)
+)
+
+func TestLogin_PostsBackTheRenderedToken(t *testing.T) {
+	app := testLoginApp(t)
+
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, httptest.NewRequest("GET", "/users/login", nil))
+	match := csrfField.FindStringSubmatch(rr.Body.String())
+	meta := csrfMeta.FindStringSubmatch(rr.Body.String())
+	if rr.Code != http.StatusOK || match == nil || meta == nil {
+		t.Fatalf("expected the login form and the layout with a csrf token, got %d: %s", rr.Code, rr.Body)
+	}
+	cookies := rr.Result().Cookies()
+
+	post := func(form url.Values, header string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/users/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if header != "" {
+			r.Header.Set("X-CSRF-Token", header)
+		}
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, r)
+		return rr
+	}
+
+	credentials := url.Values{"email": {"ada@example.com"}, "password": {"password"}}
+	if rr := post(credentials, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("expected a post without the token refused, got %d", rr.Code)
+	}
+	// scripts send the token of the meta tag in the header
+	if rr := post(credentials, meta[1]); rr.Code != http.StatusSeeOther {
+		t.Errorf("expected the token of the meta tag to be accepted, got %d: %s", rr.Code, rr.Body)
+	}
+	credentials.Set("csrf_token", match[1])
+	if rr := post(credentials, ""); rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/" {
+		t.Errorf("expected the login to go through, got %d %v: %s", rr.Code, rr.Header(), rr.Body)
+	}
+}
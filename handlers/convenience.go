@@ -2,14 +2,122 @@ package handlers
 
 import (
 	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
 	"net/http"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/justinas/nosurf"
+	"github.com/prateekjoshi2013/scotch-primer/logging"
+	"github.com/prateekjoshi2013/scotch-primer/middlewares"
+	"github.com/prateekjoshi2013/scotch-primer/tracing"
+	"github.com/prateekjoshi2013/scotch/render"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// render renders tmpl with the engine set by RENDERER
 func (h *Handlers) render(w http.ResponseWriter, r *http.Request, tmpl string, variables, data interface{}) error {
-	if err := h.App.Render.Page(w, r, tmpl, variables, data); err != nil {
-		return err
+	return h.renderWith(w, r, "", tmpl, variables, data)
+}
+
+// renderWith renders the page tmpl with engine, "go" or "jet", or with the
+// configured one when engine is empty, see renderView. Jet pages also get
+// the pending flash messages as flashes, which the base layout shows.
+func (h *Handlers) renderWith(w http.ResponseWriter, r *http.Request, engine, tmpl string, variables, data interface{}) error {
+	if engine == "jet" || engine == "" && h.App.Render.Renderer == "jet" {
+		vars := jetVars(variables)
+		vars.Set("flashes", h.popFlashes(r.Context()))
+		variables = vars
+	}
+	return h.renderView(w, r, engine, tmpl, variables, data)
+}
+
+// renderView renders tmpl like renderWith, leaving the flash messages for
+// the next page, and records the rendering as a span. Templates of both
+// engines get the csrf token of the session as .CSRFToken, which scotch
+// doesn't set. Jet templates get the nonce of inline scripts as cspNonce,
+// Go templates as .StringMap.cspNonce.
+func (h *Handlers) renderView(w http.ResponseWriter, r *http.Request, engine, tmpl string, variables, data interface{}) (err error) {
+	label := engine
+	if label == "" {
+		label = h.App.Render.Renderer
 	}
-	return nil
+	nonce := middlewares.CSPNonce(r.Context())
+	td, _ := data.(*render.TemplateData)
+	if td == nil {
+		td = &render.TemplateData{}
+	}
+	td.CSRFToken = nosurf.Token(r)
+	data = td
+	switch label {
+	case "jet":
+		vars := jetVars(variables)
+		vars.Set("cspNonce", nonce)
+		variables = vars
+	case "go":
+		if td.StringMap == nil {
+			td.StringMap = make(map[string]string)
+		}
+		td.StringMap["cspNonce"] = nonce
+	}
+	ctx, span := tracing.Tracer().Start(r.Context(), "render "+tmpl, trace.WithAttributes(
+		attribute.String("template.name", tmpl),
+		attribute.String("template.engine", label),
+	))
+	defer func() { tracing.End(span, err) }()
+	r = r.WithContext(ctx)
+
+	switch {
+	case label == "go" && h.Views != nil:
+		return h.goPage(w, r, tmpl, td)
+	case engine == "go":
+		return h.App.Render.GoPage(w, r, tmpl, variables, data)
+	case engine == "jet":
+		return h.App.Render.JetPage(w, r, tmpl, variables, data)
+	default:
+		return h.App.Render.Page(w, r, tmpl, variables, data)
+	}
+}
+
+func jetVars(variables interface{}) jet.VarMap {
+	vars, _ := variables.(jet.VarMap)
+	if vars == nil {
+		vars = make(jet.VarMap)
+	}
+	return vars
+}
+
+// goPage renders views/tmpl.page.tmpl from Views, with the data scotch gives
+// the Go templates it renders itself, and the asset function
+func (h *Handlers) goPage(w http.ResponseWriter, r *http.Request, tmpl string, td *render.TemplateData) error {
+	t, err := template.New(tmpl+".page.tmpl").
+		Funcs(template.FuncMap{"asset": h.asset}).
+		ParseFS(h.Views, tmpl+".page.tmpl")
+	if err != nil {
+		return fmt.Errorf("parsing template %s: %w", tmpl, err)
+	}
+	td.IsAuthenticated = h.App.Session.Exists(r.Context(), "userID")
+	td.Secure = h.App.Render.Secure
+	td.ServerName = h.App.Render.ServerName
+	td.Port = h.App.Render.Port
+	return t.Execute(w, td)
+}
+
+// asset returns the url of the static asset name, plain when there is no
+// Asset
+func (h *Handlers) asset(name string) string {
+	if h.Asset == nil {
+		return "/public/" + strings.TrimPrefix(name, "/")
+	}
+	return h.Asset(name)
+}
+
+// logger returns the logger of the request, tagged with its id, route and user
+func (h *Handlers) logger(r *http.Request) *slog.Logger {
+	return logging.FromContext(r.Context())
 }
 
 func (h *Handlers) sessionPut(ctx context.Context, key string, val interface{}) {
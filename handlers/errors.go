@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/justinas/nosurf"
+	"github.com/prateekjoshi2013/scotch-primer/data"
+)
+
+// HTTPError is a failure with the status to respond with and a message that
+// is safe to show the client. Err, when set, is only logged, and shown in
+// DEBUG.
+type HTTPError struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// NewError returns an HTTPError with the given status and message
+func NewError(status int, message string, err error) *HTTPError {
+	return &HTTPError{Status: status, Message: message, Err: err}
+}
+
+// panicError is a panic recovered by Handle, with the stack it happened on
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// HandlerFunc is a handler that returns its failure for Handle to report,
+// instead of writing the response itself
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// Handle adapts fn to an http.HandlerFunc: an error it returns, or a panic,
+// is written with Error
+func (h *Handlers) Handle(fn HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				h.Error(w, r, &panicError{value: v, stack: debug.Stack()})
+			}
+		}()
+		if err := fn(w, r); err != nil {
+			h.Error(w, r, err)
+		}
+	}
+}
+
+// Error logs err and responds with the error page for its status, or with a
+// json body on the api. The status comes from an HTTPError, or from
+// data.HTTPStatus for the errors of the data package. Server errors only
+// show the status text, unless DEBUG is on.
+func (h *Handlers) Error(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusInternalServerError, ""
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		status, message = httpErr.Status, httpErr.Message
+	} else if s := data.HTTPStatus(err); s != http.StatusInternalServerError {
+		// only the data package error itself is meant for the client, not
+		// the context it was wrapped in
+		status, message = s, data.PublicMessage(err)
+	}
+	if status >= http.StatusInternalServerError || message == "" {
+		message = http.StatusText(status)
+	}
+
+	if status >= http.StatusInternalServerError {
+		h.logger(r).Error("handling request", "status", status, "error", err)
+	} else {
+		h.logger(r).Debug("request failed", "status", status, "error", err)
+	}
+
+	details := ""
+	if h.App.Debug && err.Error() != message {
+		details = err.Error()
+		var p *panicError
+		if errors.As(err, &p) {
+			details += "\n\n" + string(p.stack)
+		}
+	}
+
+	if wantsJSON(r) {
+		payload := errorPayload{
+			Error:     true,
+			Status:    status,
+			Message:   message,
+			RequestID: w.Header().Get("X-Request-ID"),
+			Details:   details,
+		}
+		if err := h.App.WriteJSON(w, status, payload); err != nil {
+			h.logger(r).Error("writing error response", "error", err)
+		}
+		return
+	}
+	h.errorPage(w, r, status, message, details)
+}
+
+// errorPayload is the body of the api error responses
+type errorPayload struct {
+	Error     bool   `json:"error"`
+	Status    int    `json:"status"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+	Details   string `json:"details,omitempty"`
+	// Errors are the messages of the invalid fields, by field
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// errorPage renders views/errors/error.jet, the page of every status
+func (h *Handlers) errorPage(w http.ResponseWriter, r *http.Request, status int, message, details string) {
+	const tmpl = "errors/error"
+	vars := make(jet.VarMap)
+	vars.Set("status", status)
+	vars.Set("title", http.StatusText(status))
+	vars.Set("message", message)
+	vars.Set("details", details)
+	vars.Set("requestID", w.Header().Get("X-Request-ID"))
+
+	w.Header().Set("Cache-Control", "no-store")
+	page := &pageBuffer{ResponseWriter: w}
+	// an error page, often for a request the user didn't see, such as the
+	// favicon, mustn't use up the flash messages meant for the next page
+	if err := h.renderView(page, r, "jet", tmpl, vars, nil); err != nil {
+		h.logger(r).Error("rendering error page", "template", tmpl, "error", err)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		fmt.Fprintln(w, message)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	page.body.WriteTo(w)
+}
+
+// NotFound responds to the requests no route matches
+func (h *Handlers) NotFound(w http.ResponseWriter, r *http.Request) {
+	h.Error(w, r, NewError(http.StatusNotFound, "The page you are looking for doesn't exist.", nil))
+}
+
+// MethodNotAllowed responds to requests whose route exists, but not for
+// their method
+func (h *Handlers) MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	h.Error(w, r, NewError(http.StatusMethodNotAllowed, r.Method+" is not supported here.", nil))
+}
+
+// CSRFFailure responds to the unsafe requests refused by the CSRF middleware,
+// usually a form left open past the end of its session
+func (h *Handlers) CSRFFailure(w http.ResponseWriter, r *http.Request) {
+	h.Error(w, r, NewError(http.StatusForbidden,
+		"This form has expired. Please go back, reload the page and try again.", nosurf.Reason(r)))
+}
+
+// TooManyRequests responds to the requests refused by a rate limit, which
+// has set Retry-After
+func (h *Handlers) TooManyRequests(w http.ResponseWriter, r *http.Request) {
+	h.Error(w, r, NewError(http.StatusTooManyRequests,
+		"You are making requests too quickly. Please wait a moment and try again.", nil))
+}
+
+// wantsJSON reports whether to answer with json rather than a page: for the
+// api, for clients asking for json rather than html, and for clients
+// posting json without asking for anything in particular
+func wantsJSON(r *http.Request) bool {
+	if r.URL.Path == "/api" || strings.HasPrefix(r.URL.Path, "/api/") {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	if strings.Contains(accept, "text/html") {
+		return false
+	}
+	if strings.Contains(accept, "application/json") {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/prateekjoshi2013/scotch"
+	"github.com/prateekjoshi2013/scotch-primer/data"
+	"github.com/prateekjoshi2013/scotch/render"
+)
+
+func apiError(t *testing.T, h *Handlers, fn HandlerFunc) (int, errorPayload) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	rr.Header().Set("X-Request-ID", "req-1")
+	h.Handle(fn)(rr, httptest.NewRequest("GET", "/api/users", nil))
+
+	var payload errorPayload
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("expected a json body, got %q: %v", rr.Body.String(), err)
+	}
+	return rr.Code, payload
+}
+
+func TestError_JSON(t *testing.T) {
+	h := &Handlers{App: &scotch.Scotch{}}
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		message string
+	}{
+		{"http error", NewError(http.StatusBadRequest, "bad input", errors.New("eof")), http.StatusBadRequest, "bad input"},
+		{"data error", data.ErrNotFound, http.StatusNotFound, "record not found"},
+		{"wrapped data error", fmt.Errorf("loading user 42: %w", data.ErrDuplicateEmail), http.StatusConflict,
+			data.ErrDuplicateEmail.Error()},
+		{"constraint error", &data.ConstraintError{Constraint: "users.email_index"}, http.StatusConflict,
+			"the record conflicts with an existing one"},
+		{"internal error", errors.New("pq: connection refused"), http.StatusInternalServerError, "Internal Server Error"},
+		{"internal http error", NewError(http.StatusBadGateway, "upstream said no", nil), http.StatusBadGateway, "Bad Gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, payload := apiError(t, h, func(w http.ResponseWriter, r *http.Request) error { return tt.err })
+			if status != tt.status || payload.Status != tt.status || payload.Message != tt.message {
+				t.Errorf("expected %d %q, got %d %+v", tt.status, tt.message, status, payload)
+			}
+			if !payload.Error || payload.RequestID != "req-1" {
+				t.Errorf("expected the error flag and request id, got %+v", payload)
+			}
+			if payload.Details != "" {
+				t.Errorf("expected no details outside DEBUG, got %q", payload.Details)
+			}
+		})
+	}
+}
+
+func TestError_DebugDetails(t *testing.T) {
+	h := &Handlers{App: &scotch.Scotch{Debug: true}}
+	_, payload := apiError(t, h, func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("pq: connection refused")
+	})
+	if payload.Message != "Internal Server Error" || payload.Details != "pq: connection refused" {
+		t.Errorf("expected the error in the details only, got %+v", payload)
+	}
+
+	status, payload := apiError(t, h, func(w http.ResponseWriter, r *http.Request) error {
+		var m map[string]int
+		m["boom"]++
+		return nil
+	})
+	if status != http.StatusInternalServerError {
+		t.Errorf("expected a panic to be a 500, got %d", status)
+	}
+	if !strings.Contains(payload.Details, "assignment to entry in nil map") || !strings.Contains(payload.Details, "errors_test.go") {
+		t.Errorf("expected the panic and its stack in the details, got %q", payload.Details)
+	}
+}
+
+func TestError_Page(t *testing.T) {
+	session := scs.New()
+	h := &Handlers{App: &scotch.Scotch{Session: session, Render: &render.Render{Renderer: "jet", JetViews: testViews(t), Session: session}}}
+	tests := []struct {
+		name     string
+		err      error
+		status   int
+		contains string
+	}{
+		{"not found", fmt.Errorf("loading user 42: %w", data.ErrNotFound), http.StatusNotFound, data.ErrNotFound.Error()},
+		{"method", NewError(http.StatusMethodNotAllowed, "DELETE is not supported here.", nil), http.StatusMethodNotAllowed, "DELETE is not supported here."},
+		{"internal error", errors.New("pq: connection refused"), http.StatusInternalServerError, "Please try again in a moment."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			session.LoadAndSave(h.Handle(func(w http.ResponseWriter, r *http.Request) error { return tt.err })).
+				ServeHTTP(rr, httptest.NewRequest("GET", "/users/42", nil))
+			body := rr.Body.String()
+			if rr.Code != tt.status || !strings.Contains(body, http.StatusText(tt.status)) || !strings.Contains(body, tt.contains) {
+				t.Errorf("expected the %d page with %q, got %d: %s", tt.status, tt.contains, rr.Code, body)
+			}
+			if strings.Contains(body, "loading user") || strings.Contains(body, "pq:") {
+				t.Errorf("expected the internal error to be left out, got %s", body)
+			}
+		})
+	}
+}
+
+func TestWantsJSON(t *testing.T) {
+	tests := []struct {
+		path, accept, contentType string
+		want                      bool
+	}{
+		{"/api/users", "", "", true},
+		{"/api", "text/html", "", true},
+		{"/apiary", "", "", false},
+		{"/users", "application/json", "", true},
+		{"/users", "text/html,application/xhtml+xml,application/json;q=0.9", "", false},
+		{"/users", "*/*", "", false},
+		{"/form", "*/*", "application/json; charset=utf-8", true},
+		{"/form", "", "application/x-www-form-urlencoded", false},
+		{"/form", "text/html", "application/json", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		r.Header.Set("Accept", tt.accept)
+		r.Header.Set("Content-Type", tt.contentType)
+		if got := wantsJSON(r); got != tt.want {
+			t.Errorf("%s with Accept %q and Content-Type %q: expected %v, got %v", tt.path, tt.accept, tt.contentType, tt.want, got)
+		}
+	}
+}
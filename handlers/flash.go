@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"encoding/gob"
+)
+
+// FlashLevel is the kind of a flash message, which sets how it is shown
+type FlashLevel string
+
+const (
+	FlashSuccess FlashLevel = "success"
+	FlashInfo    FlashLevel = "info"
+	FlashWarning FlashLevel = "warning"
+	FlashError   FlashLevel = "error"
+)
+
+// Flash is a message kept in the session until the next page is rendered,
+// usually the one redirected to
+type Flash struct {
+	Level   FlashLevel
+	Message string
+}
+
+// Class is the bootstrap alert class of the level
+func (f Flash) Class() string {
+	if f.Level == FlashError {
+		return "danger"
+	}
+	return string(f.Level)
+}
+
+const flashKey = "flash"
+
+func init() {
+	// the session stores encode their values with gob
+	gob.Register([]Flash{})
+}
+
+// Flash adds a message to show on the next page rendered for the session
+func (h *Handlers) Flash(ctx context.Context, level FlashLevel, message string) {
+	flashes, _ := h.sessionGet(ctx, flashKey).([]Flash)
+	h.sessionPut(ctx, flashKey, append(flashes, Flash{Level: level, Message: message}))
+}
+
+// popFlashes returns the pending messages and removes them from the session
+func (h *Handlers) popFlashes(ctx context.Context) []Flash {
+	flashes, _ := h.sessionGet(ctx, flashKey).([]Flash)
+	h.sessionRemove(ctx, flashKey)
+	return flashes
+}
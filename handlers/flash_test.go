@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/alexedwards/scs/v2"
+	"github.com/prateekjoshi2013/scotch"
+	"github.com/prateekjoshi2013/scotch/render"
+)
+
+func TestFlash_SurvivesOneRedirect(t *testing.T) {
+	h := &Handlers{App: &scotch.Scotch{Session: scs.New()}}
+	var got []Flash
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		h.Flash(r.Context(), FlashSuccess, "Welcome back!")
+		h.Flash(r.Context(), FlashError, "Something else")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		got = h.popFlashes(r.Context())
+	})
+	srv := h.App.Session.LoadAndSave(mux)
+
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("POST", "/login", nil))
+	cookies := rr.Result().Cookies()
+
+	get := func() []Flash {
+		got = nil
+		r := httptest.NewRequest("GET", "/", nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		srv.ServeHTTP(httptest.NewRecorder(), r)
+		return got
+	}
+
+	flashes := get()
+	if len(flashes) != 2 || flashes[0].Message != "Welcome back!" || flashes[1].Level != FlashError {
+		t.Fatalf("expected both flashes after the redirect, got %+v", flashes)
+	}
+	if flashes[0].Class() != "success" || flashes[1].Class() != "danger" {
+		t.Errorf("expected the bootstrap classes, got %q and %q", flashes[0].Class(), flashes[1].Class())
+	}
+	if flashes := get(); len(flashes) != 0 {
+		t.Errorf("expected the flashes to be shown only once, got %+v", flashes)
+	}
+}
+
+func TestFlash_KeptByErrorPages(t *testing.T) {
+	session := scs.New()
+	h := &Handlers{App: &scotch.Scotch{Session: session, Render: &render.Render{Renderer: "jet", JetViews: testViews(t), Session: session}}}
+	var got []Flash
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		h.Flash(r.Context(), FlashSuccess, "Welcome back!")
+	})
+	mux.HandleFunc("/favicon.ico", h.NotFound)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		got = h.popFlashes(r.Context())
+	})
+	srv := session.LoadAndSave(mux)
+
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest("POST", "/login", nil))
+	cookies := rr.Result().Cookies()
+	for _, path := range []string{"/favicon.ico", "/"} {
+		r := httptest.NewRequest("GET", path, nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, r)
+		if path == "/favicon.ico" && (rr.Code != http.StatusNotFound || strings.Contains(rr.Body.String(), "Welcome back!")) {
+			t.Errorf("expected the 404 page without the flash, got %d: %s", rr.Code, rr.Body)
+		}
+	}
+	if len(got) != 1 || got[0].Message != "Welcome back!" {
+		t.Errorf("expected the flash on the page after the 404, got %+v", got)
+	}
+}
+
+// testViews returns the jet set of the views of the app
+func testViews(t *testing.T) *jet.Set {
+	t.Helper()
+	views := jet.NewSet(jet.NewOSFileSystemLoader("../views"))
+	views.AddGlobal("asset", func(name string) string { return "/public/" + name })
+	return views
+}
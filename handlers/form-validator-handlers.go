@@ -1,49 +1,37 @@
 package handlers
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/CloudyKit/jet/v6"
 	"github.com/prateekjoshi2013/scotch-primer/data"
+	"github.com/prateekjoshi2013/scotch-primer/forms"
 )
 
-func (h *Handlers) Form(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) Form(w http.ResponseWriter, r *http.Request) error {
 	vars := make(jet.VarMap)
 	validator := h.App.Validator(nil)
 	vars.Set("validator", validator)
-	vars.Set("user", data.User{})
-	err := h.App.Render.JetPage(w, r, "form", vars, nil)
-	if err != nil {
-		h.App.ErrorLog.Println("error rendering:", err)
-	}
+	vars.Set("user", userView{})
+	return h.renderWith(w, r, "jet", "form", vars, nil)
 }
 
-func (h *Handlers) SubmitForm(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
-	if err != nil {
-		h.App.ErrorLog.Println("error parsing form:", err)
-		return
-	}
+// SubmitForm validates the form, posted by a browser or as json by a
+// client; see respond
+func (h *Handlers) SubmitForm(w http.ResponseWriter, r *http.Request) error {
+	var user data.User
 	validator := h.App.Validator(nil)
-	validator.Required(r, "first_name", "last_name", "email")
-	validator.IsEmail("email", r.Form.Get("email"))
-	validator.Check(len(r.Form.Get("first_name")) > 1, "first_name", "must be more than 1 character")
-	validator.Check(len(r.Form.Get("last_name")) > 1, "first_name", "must be more than 1 character")
+	if err := forms.Decode(r, &user, validator); err != nil {
+		return NewError(http.StatusBadRequest, "The form could not be read.", err)
+	}
+	result := map[string]interface{}{"user": newUserView(&user)}
 	if !validator.Valid() {
-		vars := make(jet.VarMap)
-		vars.Set("validator", validator)
-		var user data.User
-		user.FirstName = r.Form.Get("first_name")
-		user.LastName = r.Form.Get("last_name")
-		user.Email = r.Form.Get("email")
-		vars.Set("user", user)
-
-		if err := h.App.Render.Page(w, r, "form", vars, nil); err != nil {
-			h.App.ErrorLog.Println("error rendering:", err)
-			return
-		}
-		return
+		return h.respondInvalid(w, r, "form", result, validator)
+	}
+	if wantsJSON(r) {
+		return h.respond(w, r, http.StatusOK, "form", result)
 	}
-	fmt.Fprint(w, "valid data")
+	h.Flash(r.Context(), FlashSuccess, "Thanks, everything you entered is valid.")
+	http.Redirect(w, r, "/form", http.StatusSeeOther)
+	return nil
 }
@@ -1,48 +1,46 @@
 package handlers
 
 import (
+	"io/fs"
 	"net/http"
 
 	"github.com/CloudyKit/jet/v6"
 	"github.com/prateekjoshi2013/scotch"
 	"github.com/prateekjoshi2013/scotch-primer/data"
+	"github.com/prateekjoshi2013/scotch-primer/jobs"
 )
 
 type Handlers struct {
 	App    *scotch.Scotch
 	Models data.Models
+	// Jobs is nil when there is no database
+	Jobs *jobs.Queue
+	// Views are the templates Go pages are rendered from; scotch renders
+	// them from the project directory when it is nil
+	Views fs.FS
+	// Asset returns the url of a static asset, for the asset function of
+	// the templates
+	Asset func(name string) string
 }
 
-func (h *Handlers) Home(w http.ResponseWriter, r *http.Request) {
-	err := h.App.Render.Page(w, r, "home", nil, nil)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+func (h *Handlers) Home(w http.ResponseWriter, r *http.Request) error {
+	return h.render(w, r, "home", nil, nil)
 }
 
-func (h *Handlers) GoPage(w http.ResponseWriter, r *http.Request) {
-	err := h.App.Render.GoPage(w, r, "home", nil, nil)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+func (h *Handlers) GoPage(w http.ResponseWriter, r *http.Request) error {
+	return h.renderWith(w, r, "go", "home", nil, nil)
 }
 
-func (h *Handlers) JetPage(w http.ResponseWriter, r *http.Request) {
-	err := h.App.Render.JetPage(w, r, "jet-template", nil, nil)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+func (h *Handlers) JetPage(w http.ResponseWriter, r *http.Request) error {
+	return h.renderWith(w, r, "jet", "jet-template", nil, nil)
 }
 
-func (h *Handlers) SessionTest(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) SessionTest(w http.ResponseWriter, r *http.Request) error {
 	myData := "bar"
 	h.App.Session.Put(r.Context(), "foo", myData)
 	myValue := h.App.Session.Get(r.Context(), "foo")
 	vars := make(jet.VarMap)
 	vars.Set("foo", myValue)
 
-	err := h.App.Render.JetPage(w, r, "sessions", vars, nil)
-	if err != nil {
-		h.App.ErrorLog.Println("error rendering:", err)
-	}
+	return h.renderWith(w, r, "jet", "sessions", vars, nil)
 }
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/prateekjoshi2013/scotch"
+	"github.com/prateekjoshi2013/scotch/render"
+)
+
+func TestGoPage_FromViews(t *testing.T) {
+	session := scs.New()
+	h := &Handlers{
+		App: &scotch.Scotch{Session: session, Render: &render.Render{Renderer: "go", ServerName: "example.com", JetViews: testViews(t)}},
+		Views: fstest.MapFS{
+			"home.page.tmpl": {Data: []byte(`{{.ServerName}} {{.IsAuthenticated}} <script nonce="{{.StringMap.cspNonce}}"></script> <img src="{{asset "logo.png"}}">`)},
+		},
+		Asset: func(name string) string { return "/public/logo.1234.png" },
+	}
+	var rr *httptest.ResponseRecorder
+	serve := func(fn HandlerFunc) {
+		rr = httptest.NewRecorder()
+		session.LoadAndSave(h.Handle(fn)).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	}
+
+	serve(h.Home)
+	if body := rr.Body.String(); rr.Code != http.StatusOK || !strings.HasPrefix(body, "example.com false") ||
+		!strings.Contains(body, `src="/public/logo.1234.png"`) {
+		t.Errorf("expected the page from the views, got %d %q", rr.Code, body)
+	}
+
+	serve(func(w http.ResponseWriter, r *http.Request) error {
+		return h.renderWith(w, r, "go", "missing", nil, nil)
+	})
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected a missing template to fail, got %d", rr.Code)
+	}
+}
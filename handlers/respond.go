@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/prateekjoshi2013/scotch"
+)
+
+// respond answers with data, as a json object for the clients that want
+// json, see wantsJSON, or as the page view with data as its variables
+func (h *Handlers) respond(w http.ResponseWriter, r *http.Request, status int, view string, data map[string]interface{}) error {
+	if wantsJSON(r) {
+		return h.App.WriteJSON(w, status, data)
+	}
+	vars := make(jet.VarMap)
+	for name, value := range data {
+		vars.Set(name, value)
+	}
+	page := &pageBuffer{ResponseWriter: w}
+	if err := h.render(page, r, view, vars, nil); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, err := page.body.WriteTo(w)
+	return err
+}
+
+// pageBuffer holds a page while it is rendered, so that nothing is sent
+// when rendering fails halfway and the error can still be answered cleanly.
+// Headers go straight to the response.
+type pageBuffer struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (p *pageBuffer) Write(b []byte) (int, error) {
+	return p.body.Write(b)
+}
+
+func (p *pageBuffer) WriteHeader(int) {}
+
+// respondInvalid answers a submission that failed validation with a 422.
+// Json clients get an error whose errors hold the message of each field;
+// browsers get view again, with validator for the form to show the errors
+// next to their fields, and a flash message.
+func (h *Handlers) respondInvalid(w http.ResponseWriter, r *http.Request, view string, data map[string]interface{}, validator *scotch.Validation) error {
+	status := http.StatusUnprocessableEntity
+	if wantsJSON(r) {
+		return h.App.WriteJSON(w, status, errorPayload{
+			Error:     true,
+			Status:    status,
+			Message:   "The submitted data is invalid.",
+			RequestID: w.Header().Get("X-Request-ID"),
+			Errors:    validator.Errors,
+		})
+	}
+	vars := map[string]interface{}{"validator": validator}
+	for name, value := range data {
+		vars[name] = value
+	}
+	h.Flash(r.Context(), FlashError, "Please correct the errors below.")
+	return h.respond(w, r, status, view, vars)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/prateekjoshi2013/scotch"
+	"github.com/prateekjoshi2013/scotch/render"
+)
+
+func submitForm(t *testing.T, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	session := scs.New()
+	h := &Handlers{App: &scotch.Scotch{Session: session, Render: &render.Render{Renderer: "jet", JetViews: testViews(t), Session: session}}}
+	r := httptest.NewRequest("POST", "/form", strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	session.LoadAndSave(h.Handle(h.SubmitForm)).ServeHTTP(rr, r)
+	return rr
+}
+
+func TestSubmitForm_JSON(t *testing.T) {
+	rr := submitForm(t, "application/json", `{"first_name": "Ada", "last_name": "L", "email": "ada@"}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d: %s", rr.Code, rr.Body)
+	}
+	var payload errorPayload
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Errors) != 2 || payload.Errors["last_name"] == "" || payload.Errors["email"] == "" {
+		t.Errorf("expected the errors of last_name and email, got %+v", payload)
+	}
+
+	rr = submitForm(t, "application/json", `{"first_name": "Ada", "last_name": "Lovelace", "email": "ada@example.com"}`)
+	var result struct {
+		User userView `json:"user"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected the user back, got %d: %s", rr.Code, rr.Body)
+	}
+	if result.User.LastName != "Lovelace" || strings.Contains(rr.Body.String(), "assword") {
+		t.Errorf("expected the user view, got %s", rr.Body)
+	}
+}
+
+func TestRespond_RenderFailure(t *testing.T) {
+	session := scs.New()
+	h := &Handlers{App: &scotch.Scotch{Session: session, Render: &render.Render{Renderer: "jet", JetViews: testViews(t), Session: session}}}
+	rr := httptest.NewRecorder()
+	session.LoadAndSave(h.Handle(func(w http.ResponseWriter, r *http.Request) error {
+		// the form view, without the variables it needs
+		return h.respond(w, r, http.StatusUnprocessableEntity, "form", nil)
+	})).ServeHTTP(rr, httptest.NewRequest("GET", "/form", nil))
+	if rr.Code != http.StatusInternalServerError || strings.Contains(rr.Body.String(), "Form Validation") {
+		t.Errorf("expected only the error page, got %d: %s", rr.Code, rr.Body)
+	}
+}
+
+func TestSubmitForm_Browser(t *testing.T) {
+	rr := submitForm(t, "application/x-www-form-urlencoded", "first_name=Ada&last_name=L&email=ada@example.com")
+	if rr.Code != http.StatusUnprocessableEntity || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("expected the form page again with 422, got %d %v", rr.Code, rr.Header())
+	}
+	body := rr.Body.String()
+	for _, want := range []string{`value="Ada"`, "must be at least 2 characters", "Please correct the errors below."} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected the form page to contain %q, got %s", want, body)
+		}
+	}
+	if strings.Count(body, "is-invalid") != 1 {
+		t.Errorf("expected only last_name marked invalid, got %s", body)
+	}
+
+	rr = submitForm(t, "application/x-www-form-urlencoded", "first_name=Ada&last_name=Lovelace&email=ada@example.com")
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/form" {
+		t.Errorf("expected a redirect to the form, got %d %v", rr.Code, rr.Header())
+	}
+}
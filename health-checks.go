@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/gomodule/redigo/redis"
+	"github.com/prateekjoshi2013/scotch-primer/health"
+)
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = ""
+
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				return s.Value
+			}
+		}
+	}
+	return "dev"
+}
+
+// registerHealthChecks adds a readiness check for every dependency the
+// configuration says we use
+func (a *application) registerHealthChecks() {
+	a.Health = health.New(buildVersion())
+
+	if a.App.DB.Pool != nil {
+		a.Health.Add("database", func(ctx context.Context) error {
+			return a.App.DB.Pool.PingContext(ctx)
+		})
+	}
+
+	switch a.Config.SessionType {
+	case "postgres", "postgresql", "mysql", "mariadb", "sqlite", "redis":
+		a.Health.Add("sessions", func(ctx context.Context) error {
+			// looking up a token that can't exist is a round trip to the store
+			if store, ok := a.App.Session.Store.(scs.CtxStore); ok {
+				_, _, err := store.FindCtx(ctx, "readiness-probe")
+				return err
+			}
+			_, _, err := a.App.Session.Store.Find("readiness-probe")
+			return err
+		})
+	}
+
+	// the rate limits let requests through while redis is down, so only the
+	// cache makes it a dependency
+	if a.Config.Cache == "redis" {
+		a.Health.Add("cache", func(ctx context.Context) error {
+			conn, err := a.Redis.GetContext(ctx)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			_, err = redis.DoContext(conn, ctx, "PING")
+			return err
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Package health serves the liveness and readiness endpoints used by load
+// balancers and orchestrators.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prateekjoshi2013/scotch-primer/logging"
+)
+
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+
+	defaultTimeout = 2 * time.Second
+)
+
+// Check reports whether a dependency can be used; it must honour ctx
+type Check func(ctx context.Context) error
+
+type Result struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+type Report struct {
+	Status  string            `json:"status"`
+	Version string            `json:"version"`
+	Checks  map[string]Result `json:"checks,omitempty"`
+}
+
+// Checker runs the registered dependency checks for the readiness endpoint
+type Checker struct {
+	Version string
+	// Timeout bounds each check, so one hung dependency can't hang the probe
+	Timeout time.Duration
+
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+func New(version string) *Checker {
+	return &Checker{
+		Version: version,
+		Timeout: defaultTimeout,
+		checks:  make(map[string]Check),
+	}
+}
+
+// Add registers check under name, replacing any check with the same name
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// Run runs every check concurrently and reports an error status if any
+// failed, or hadn't finished when ctx ended. The report only says which
+// checks failed, since the probes are public; why is logged.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	report := Report{
+		Status:  StatusOK,
+		Version: c.Version,
+		Checks:  make(map[string]Result, len(c.checks)),
+	}
+
+	type named struct {
+		name   string
+		result Result
+	}
+	// buffered, so that checks finishing after ctx ended don't block
+	results := make(chan named, len(c.checks))
+	for name, check := range c.checks {
+		go func(name string, check Check) {
+			ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(ctx)
+			result := Result{
+				Status:    StatusOK,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = StatusError
+				logging.FromContext(ctx).Error("health check failed", "check", name, "error", err)
+			}
+			results <- named{name, result}
+		}(name, check)
+	}
+
+	for range c.checks {
+		select {
+		case r := <-results:
+			report.Checks[r.name] = r.result
+			if r.result.Status != StatusOK {
+				report.Status = StatusError
+			}
+		case <-ctx.Done():
+			for name := range c.checks {
+				if _, ok := report.Checks[name]; !ok {
+					report.Checks[name] = Result{Status: StatusError}
+					logging.FromContext(ctx).Error("health check unfinished", "check", name, "error", ctx.Err())
+				}
+			}
+			report.Status = StatusError
+			return report
+		}
+	}
+	return report
+}
+
+// Liveness answers as long as the process can serve http at all
+func (c *Checker) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: StatusOK, Version: c.Version})
+}
+
+// Readiness answers 503 when any dependency is unavailable, so that traffic
+// is routed elsewhere until it recovers
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeReport(w, status, report)
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	out, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = w.Write(out)
+}
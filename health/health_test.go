@@ -0,0 +1,90 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChecker_Readiness(t *testing.T) {
+	c := New("1.0.0")
+	c.Add("database", func(ctx context.Context) error { return nil })
+
+	rr := httptest.NewRecorder()
+	c.Readiness(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rr.Code)
+	}
+
+	c.Add("cache", func(ctx context.Context) error { return errors.New("connection refused") })
+	rr = httptest.NewRecorder()
+	c.Readiness(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", rr.Code)
+	}
+
+	var report Report
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Version != "1.0.0" || report.Checks["database"].Status != StatusOK || report.Checks["cache"].Status != StatusError {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if strings.Contains(rr.Body.String(), "connection refused") {
+		t.Errorf("expected the error to be logged, not served: %s", rr.Body)
+	}
+}
+
+func TestChecker_Timeout(t *testing.T) {
+	c := New("dev")
+	c.Timeout = 10 * time.Millisecond
+	c.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := c.Run(context.Background())
+	if report.Status != StatusError {
+		t.Errorf("expected a timed out check to fail, got %s", report.Status)
+	}
+}
+
+func TestChecker_RunEndsWithContext(t *testing.T) {
+	c := New("dev")
+	c.Timeout = time.Minute
+	release := make(chan struct{})
+	defer close(release)
+	c.Add("hung", func(ctx context.Context) error {
+		// ignores ctx, as a driver without context support would
+		<-release
+		return nil
+	})
+	c.Add("fine", func(ctx context.Context) error { return nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	report := c.Run(ctx)
+	if time.Since(start) > time.Second {
+		t.Fatalf("expected Run to return when its context ended, took %s", time.Since(start))
+	}
+	if report.Status != StatusError || report.Checks["hung"].Status != StatusError || report.Checks["fine"].Status != StatusOK {
+		t.Errorf("expected only the hung check to fail, got %+v", report)
+	}
+}
+
+func TestChecker_Liveness(t *testing.T) {
+	c := New("dev")
+	c.Add("broken", func(ctx context.Context) error { return errors.New("down") })
+
+	rr := httptest.NewRecorder()
+	c.Liveness(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("liveness should not depend on checks, got %d", rr.Code)
+	}
+}
@@ -1,13 +1,26 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
 
+	"github.com/CloudyKit/jet/v6"
+	"github.com/CloudyKit/jet/v6/loaders/httpfs"
+
+	"github.com/alexedwards/scs/sqlite3store"
 	"github.com/prateekjoshi2013/scotch"
+	"github.com/prateekjoshi2013/scotch-primer/assets"
+	"github.com/prateekjoshi2013/scotch-primer/config"
 	"github.com/prateekjoshi2013/scotch-primer/data"
 	"github.com/prateekjoshi2013/scotch-primer/handlers"
+	"github.com/prateekjoshi2013/scotch-primer/logging"
+	"github.com/prateekjoshi2013/scotch-primer/metrics"
 	"github.com/prateekjoshi2013/scotch-primer/middlewares"
+	"github.com/prateekjoshi2013/scotch-primer/tracing"
 )
 
 func initApplication() *application {
@@ -16,34 +29,133 @@ func initApplication() *application {
 		log.Fatal(err)
 	}
 
+	cfg, err := config.Load(path + "/.env")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	scotch := &scotch.Scotch{}
 	err = scotch.New(path)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if cfg.Database.Type == "sqlite" {
+		if err := useSQLite(scotch, cfg); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// send everything, including what scotch and the standard library log,
+	// through one structured logger
+	logger := logging.New(os.Stdout, cfg.Debug)
+	slog.SetDefault(logger)
+	scotch.InfoLog = slog.NewLogLogger(logger.Handler(), slog.LevelInfo)
+	scotch.ErrorLog = slog.NewLogLogger(logger.Handler(), slog.LevelError)
+	slog.Debug("effective configuration", "config", cfg)
+
+	scotch.AppName = cfg.AppName
+
+	// scotch loads the views from the project directory; load them, and the
+	// static assets, from the binary instead
+	views := assetsFS(embeddedViews, path, "views", cfg.Debug)
+	loader, err := httpfs.NewLoader(http.FS(views))
+	if err != nil {
+		log.Fatal(err)
+	}
+	var jetOptions []jet.Option
+	if cfg.Debug {
+		jetOptions = append(jetOptions, jet.InDevelopmentMode())
+	}
+	scotch.JetViews = jet.NewSet(loader, jetOptions...)
+	scotch.Render.JetViews = scotch.JetViews
 
-	scotch.AppName = "myapp"
+	// the static assets get urls with a hash of their content, which the
+	// templates get from asset, so they can be cached for good
+	static, err := assets.New(assetsFS(embeddedPublic, path, "public", cfg.Debug), "/public", cfg.Debug)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scotch.JetViews.AddGlobal("asset", static.Path)
 
 	middleware := &middlewares.Middleware{App: scotch}
 
 	handlers := &handlers.Handlers{
-		App: scotch,
+		App:   scotch,
+		Views: views,
+		Asset: static.Path,
 	}
 
-	scotch.InfoLog.Println("Debug is set to ", scotch.Debug)
-
 	app := &application{
 		App:        scotch,
+		Config:     cfg,
 		Handlers:   handlers,
 		Middleware: middleware,
+		Assets:     static,
 	}
 
+	if cfg.Cache == "redis" || (cfg.RateLimit.Enabled && cfg.RateLimit.Store == "redis") {
+		app.Redis = newRedisPool(cfg.Redis)
+	}
+	if cfg.RateLimit.Store == "redis" {
+		app.RateLimits = middlewares.NewRedisRateLimitStore(app.Redis, cfg.Redis.Prefix)
+	} else {
+		app.RateLimits = middlewares.NewMemoryRateLimitStore()
+	}
+
+	// registered before the default hooks, so spans from their shutdown are
+	// still flushed
+	flushTraces, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName: scotch.AppName,
+		Version:     buildVersion(),
+		Exporter:    cfg.Tracing.Exporter,
+		File:        cfg.Tracing.File,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.OnShutdown("tracing", flushTraces)
+	scotch.Session.Store = tracing.SessionStore(scotch.Session.Store, cfg.SessionType)
+
+	if app.App.DB.Pool != nil {
+		if err := metrics.RegisterDB(app.App.DB.Pool, cfg.Database.Name); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	app.registerDefaultHooks()
+	app.registerHealthChecks()
+
 	app.App.Routes = app.routes()
 
 	app.Models = data.New(app.App.DB.Pool)
+	if err := data.SetKeys(cfg.Key, cfg.PreviousKeys...); err != nil {
+		log.Fatal(err)
+	}
 
 	handlers.Models = app.Models
 	app.Middleware.Models = app.Models
 
+	if app.App.DB.Pool != nil {
+		app.registerJobs()
+		app.registerMaintenance()
+		handlers.Jobs = app.Jobs
+	}
+
 	return app
 }
+
+// useSQLite connects app to the sqlite database of cfg, which scotch doesn't
+// open itself, and keeps the sessions in it when SESSION_TYPE is sqlite
+func useSQLite(app *scotch.Scotch, cfg *config.Config) error {
+	pool, err := data.OpenSQLite(cfg.Database.Name)
+	if err != nil {
+		return err
+	}
+	app.DB.DataType = "sqlite"
+	app.DB.Pool = pool
+	if cfg.SessionType == "sqlite" {
+		app.Session.Store = sqlite3store.New(pool)
+	}
+	return nil
+}
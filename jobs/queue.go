@@ -0,0 +1,295 @@
+// Package jobs is a durable background job queue stored in the jobs table of
+// the application database.
+//
+// Handlers are registered per job type with Register, and jobs enqueued with
+// Enqueue or EnqueueAt are run by a pool of workers started with Start. A job
+// whose handler fails is retried with an exponential backoff until it has
+// used its attempts, then it is kept as dead until it is retried by hand.
+// Workers claim jobs with SELECT ... FOR UPDATE SKIP LOCKED, so any number
+// of processes can share the queue.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prateekjoshi2013/scotch-primer/migrations"
+)
+
+// job statuses; finished jobs are deleted
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDead    = "dead"
+)
+
+var (
+	ErrUnknownType = errors.New("no handler registered for the job type")
+	ErrNotFound    = errors.New("job not found")
+)
+
+// Job is a row of the jobs table
+type Job struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// Handler runs one job. The context is cancelled when the job times out or
+// the queue is stopped for good.
+type Handler func(ctx context.Context, job *Job) error
+
+// Options configure a queue; zero values take the defaults, except Workers
+type Options struct {
+	// Workers is the number of jobs run at the same time; with none, the
+	// queue only enqueues and Start fails
+	Workers int
+	// PollInterval is how often idle workers look for due jobs, default 1s
+	PollInterval time.Duration
+	// MaxAttempts is how many times a job is tried before it is dead, default 5
+	MaxAttempts int
+	// Timeout is how long a job may run, default 5m. A job claimed by a
+	// worker that died is run again once its timeout has passed.
+	Timeout time.Duration
+	// Backoff returns the delay before the next try of a job that failed
+	// its attempt-th try, default exponential from 10s with jitter up to 1h
+	Backoff func(attempt int) time.Duration
+}
+
+type Queue struct {
+	db       *sql.DB
+	dialect  string
+	opts     Options
+	handlers map[string]Handler
+	now      func() time.Time
+
+	// wake lets Enqueue start an idle worker without waiting for the poll
+	wake chan struct{}
+
+	mu      sync.Mutex
+	stop    chan struct{}
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+// New returns a queue on the jobs table of db, a database of the given
+// DATABASE_TYPE
+func New(db *sql.DB, databaseType string, opts Options) *Queue {
+	if opts.Workers < 0 {
+		opts.Workers = 0
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Minute
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = Backoff
+	}
+	return &Queue{
+		db:       db,
+		dialect:  migrations.Dialect(databaseType),
+		opts:     opts,
+		handlers: make(map[string]Handler),
+		now:      func() time.Time { return time.Now().UTC() },
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Backoff is the default retry delay: 10s doubled for every failed try, plus
+// up to 20% jitter so that jobs failing together don't retry together,
+// capped at an hour
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := time.Hour
+	if attempt < 10 {
+		d = min(10*time.Second<<(attempt-1), time.Hour)
+	}
+	return d + time.Duration(rand.Int63n(int64(d/5)+1))
+}
+
+// Handle registers h to run the jobs of jobType. It must be called before
+// Start.
+func (q *Queue) Handle(jobType string, h Handler) {
+	q.handlers[jobType] = h
+}
+
+// Register registers fn to run the jobs of jobType, with their payload
+// decoded into a T. A payload that can't be decoded kills the job at once,
+// since retrying it can't help.
+func Register[T any](q *Queue, jobType string, fn func(ctx context.Context, payload T) error) {
+	q.Handle(jobType, func(ctx context.Context, job *Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return Permanent(fmt.Errorf("decoding payload: %w", err))
+		}
+		return fn(ctx, payload)
+	})
+}
+
+// permanentError is a failure that is not worth retrying
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err so that the job that returned it is dead right away
+// instead of being retried
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Enqueue adds a job of jobType to run as soon as a worker is free, with
+// payload encoded as json, and returns its id
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}) (int64, error) {
+	return q.EnqueueAt(ctx, jobType, payload, time.Time{})
+}
+
+// EnqueueAt adds a job of jobType that runs no earlier than runAt
+func (q *Queue) EnqueueAt(ctx context.Context, jobType string, payload interface{}, runAt time.Time) (int64, error) {
+	if _, ok := q.handlers[jobType]; !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownType, jobType)
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("encoding payload: %w", err)
+	}
+	now := q.now()
+	if runAt.IsZero() || runAt.Before(now) {
+		runAt = now
+	}
+
+	query := `insert into jobs (type, payload, status, max_attempts, run_at) values (?, ?, ?, ?, ?)`
+	args := []interface{}{jobType, string(b), StatusQueued, q.opts.MaxAttempts, runAt.UTC()}
+	var id int64
+	if q.dialect == "mysql" {
+		// mysql has no returning clause
+		res, err := q.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		id, err = res.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+	} else if err := q.db.QueryRowContext(ctx, q.rebind(query+` returning id`), args...).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	if !runAt.After(now) {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+	return id, nil
+}
+
+const jobColumns = `id, type, payload, status, attempts, max_attempts, run_at, last_error, created_at`
+
+// List returns the jobs with the given status, or every job when status is
+// empty, oldest first
+func (q *Queue) List(ctx context.Context, status string) ([]*Job, error) {
+	query := `select ` + jobColumns + ` from jobs`
+	var args []interface{}
+	if status != "" {
+		query += ` where status = ?`
+		args = append(args, status)
+	}
+	rows, err := q.db.QueryContext(ctx, q.rebind(query+` order by id`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// Retry queues a dead job again, with all its attempts
+func (q *Queue) Retry(ctx context.Context, id int64) error {
+	res, err := q.db.ExecContext(ctx, q.rebind(
+		`update jobs set status = ?, attempts = 0, run_at = ? where id = ? and status = ?`),
+		StatusQueued, q.now(), id, StatusDead)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row scanner) (*Job, error) {
+	var (
+		job       Job
+		payload   []byte
+		lastError sql.NullString
+	)
+	err := row.Scan(&job.ID, &job.Type, &payload, &job.Status, &job.Attempts, &job.MaxAttempts,
+		&job.RunAt, &lastError, &job.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	job.Payload = payload
+	job.LastError = lastError.String
+	return &job, nil
+}
+
+// rebind turns the ? placeholders of query into $1, $2... for postgres
+func (q *Queue) rebind(query string) string {
+	if q.dialect != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,232 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/prateekjoshi2013/scotch-primer/migrations"
+)
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+func newTestQueue(t *testing.T, opts Options) *Queue {
+	t.Helper()
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a single connection, so that the workers don't find the database locked
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	runner, err := migrations.New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if opts.PollInterval == 0 {
+		opts.PollInterval = 10 * time.Millisecond
+	}
+	return New(db, "sqlite", opts)
+}
+
+// waitFor polls cond until it holds or a few seconds have passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestQueue_Run(t *testing.T) {
+	q := newTestQueue(t, Options{Workers: 2})
+	got := make(chan string, 1)
+	Register(q, "greet", func(ctx context.Context, g greeting) error {
+		got <- g.Name
+		return nil
+	})
+
+	ctx := context.Background()
+	if _, err := q.Enqueue(ctx, "greet", greeting{Name: "ada"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop(ctx)
+
+	select {
+	case name := <-got:
+		if name != "ada" {
+			t.Errorf("expected the decoded payload, got %q", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job didn't run")
+	}
+	waitFor(t, "the finished job to be deleted", func() bool {
+		jobs, err := q.List(ctx, "")
+		return err == nil && len(jobs) == 0
+	})
+
+	if _, err := q.Enqueue(ctx, "unknown", nil); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("expected unknown job types to be rejected, got %v", err)
+	}
+}
+
+func TestQueue_RetryAndDeadLetter(t *testing.T) {
+	q := newTestQueue(t, Options{
+		Workers:     1,
+		MaxAttempts: 3,
+		Backoff:     func(int) time.Duration { return 0 },
+	})
+	runs := 0
+	q.Handle("flaky", func(ctx context.Context, job *Job) error {
+		runs++
+		return errors.New("smtp unavailable")
+	})
+
+	ctx := context.Background()
+	id, _ := q.Enqueue(ctx, "flaky", nil)
+	q.Start(ctx)
+	var dead []*Job
+	waitFor(t, "the job to be dead", func() bool {
+		dead, _ = q.List(ctx, StatusDead)
+		return len(dead) == 1
+	})
+	q.Stop(ctx)
+
+	if runs != 3 || dead[0].Attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d runs and %d attempts", runs, dead[0].Attempts)
+	}
+	if dead[0].LastError != "smtp unavailable" {
+		t.Errorf("expected the last error to be kept, got %q", dead[0].LastError)
+	}
+
+	if err := q.Retry(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	queued, _ := q.List(ctx, StatusQueued)
+	if len(queued) != 1 || queued[0].Attempts != 0 {
+		t.Errorf("expected the job to be queued with all its attempts, got %+v", queued)
+	}
+	if err := q.Retry(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected only dead jobs to be retried, got %v", err)
+	}
+}
+
+func TestQueue_Permanent(t *testing.T) {
+	q := newTestQueue(t, Options{})
+	Register(q, "greet", func(ctx context.Context, g greeting) error { return nil })
+
+	ctx := context.Background()
+	if _, err := q.Enqueue(ctx, "greet", "not an object"); err != nil {
+		t.Fatal(err)
+	}
+	job, err := q.claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.run(ctx, job)
+
+	dead, _ := q.List(ctx, StatusDead)
+	if len(dead) != 1 || dead[0].Attempts != 1 {
+		t.Errorf("expected a payload that can't be decoded to kill the job at once, got %+v", dead)
+	}
+}
+
+func TestQueue_RunAt(t *testing.T) {
+	q := newTestQueue(t, Options{Timeout: time.Minute})
+	q.Handle("later", func(ctx context.Context, job *Job) error { return nil })
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	q.EnqueueAt(ctx, "later", nil, now.Add(time.Hour))
+	if job, err := q.claim(ctx); err != nil || job != nil {
+		t.Fatalf("expected no job to be due, got %+v, %v", job, err)
+	}
+
+	now = now.Add(time.Hour)
+	job, err := q.claim(ctx)
+	if err != nil || job == nil {
+		t.Fatalf("expected the job to be due, got %v", err)
+	}
+	if again, _ := q.claim(ctx); again != nil {
+		t.Error("expected a claimed job not to be claimed twice")
+	}
+
+	// its worker died: the job is claimed again once its timeout has passed
+	now = now.Add(2*time.Minute + time.Second)
+	again, err := q.claim(ctx)
+	if err != nil || again == nil || again.ID != job.ID || again.Attempts != 2 {
+		t.Errorf("expected the abandoned job to be claimed again, got %+v, %v", again, err)
+	}
+}
+
+func TestQueue_StopInterrupts(t *testing.T) {
+	q := newTestQueue(t, Options{Workers: 1})
+	started := make(chan struct{})
+	q.Handle("slow", func(ctx context.Context, job *Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx := context.Background()
+	q.Enqueue(ctx, "slow", nil)
+	q.Start(ctx)
+	<-started
+
+	stopCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := q.Stop(stopCtx); err != nil {
+		t.Fatal(err)
+	}
+	queued, _ := q.List(ctx, StatusQueued)
+	if len(queued) != 1 || queued[0].Attempts != 0 {
+		t.Errorf("expected the interrupted job to be queued again without using an attempt, got %+v", queued)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	q := &Queue{dialect: "postgres"}
+	if got := q.rebind("select ? where a = ? and b = ?"); got != "select $1 where a = $2 and b = $3" {
+		t.Errorf("unexpected query %q", got)
+	}
+	q.dialect = "mysql"
+	if got := q.rebind("select ?"); got != "select ?" {
+		t.Errorf("expected mysql placeholders to be left alone, got %q", got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{1: 10 * time.Second, 3: 40 * time.Second, 20: time.Hour} {
+		got := Backoff(attempt)
+		if got < want || got > want+want/5 {
+			t.Errorf("attempt %d: expected %s plus jitter, got %s", attempt, want, got)
+		}
+	}
+}
+
+func TestQueue_NoWorkers(t *testing.T) {
+	q := newTestQueue(t, Options{})
+	Register(q, "greet", func(ctx context.Context, g greeting) error { return nil })
+	if err := q.Start(context.Background()); err == nil {
+		t.Error("expected a queue without workers to refuse to start")
+	}
+	if _, err := q.Enqueue(context.Background(), "greet", nil); err != nil {
+		t.Errorf("expected a queue without workers to enqueue, got %v", err)
+	}
+}
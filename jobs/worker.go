@@ -0,0 +1,256 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/prateekjoshi2013/scotch-primer/logging"
+	"github.com/prateekjoshi2013/scotch-primer/metrics"
+	"github.com/prateekjoshi2013/scotch-primer/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errStopped is the cause of the cancellation of jobs interrupted by Stop
+var errStopped = errors.New("job queue stopped")
+
+// Start starts the workers. They keep running after ctx is done, until Stop
+// is called.
+func (q *Queue) Start(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stop != nil {
+		return errors.New("job queue already started")
+	}
+	if q.opts.Workers == 0 {
+		return errors.New("job queue has no workers to start")
+	}
+
+	// ctx is usually cancelled by the signal that begins the shutdown, and
+	// running jobs should get the chance to finish
+	ctx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	q.stop = make(chan struct{})
+	q.cancel = func() { cancel(errStopped) }
+	for i := 0; i < q.opts.Workers; i++ {
+		q.workers.Add(1)
+		go q.work(ctx)
+	}
+	slog.Info("job workers started", "workers", q.opts.Workers)
+	return nil
+}
+
+// Stop stops claiming jobs and waits for the running ones. When ctx is done
+// first, their contexts are cancelled and they are queued again without
+// using up an attempt.
+func (q *Queue) Stop(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stop == nil {
+		return nil
+	}
+	select {
+	case <-q.stop:
+		return nil
+	default:
+	}
+	close(q.stop)
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	q.cancel()
+	// a moment for the interrupted jobs to be released
+	select {
+	case <-done:
+		return nil
+	case <-time.After(time.Second):
+		return fmt.Errorf("jobs still running: %w", ctx.Err())
+	}
+}
+
+func (q *Queue) work(ctx context.Context) {
+	defer q.workers.Done()
+	timer := time.NewTimer(q.opts.PollInterval)
+	timer.Stop()
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		job, err := q.claim(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("claiming job", "error", err)
+		}
+		if job != nil {
+			q.run(ctx, job)
+			continue
+		}
+
+		timer.Reset(q.opts.PollInterval)
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+}
+
+// claim locks the next due job and marks it as running. Its run_at is moved
+// past its timeout, so that it is claimed again if this worker dies.
+func (q *Queue) claim(ctx context.Context) (*Job, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `select ` + jobColumns + ` from jobs where status in (?, ?) and run_at <= ? order by run_at, id limit 1`
+	if q.dialect != "sqlite" {
+		query += ` for update skip locked`
+	}
+	now := q.now()
+	job, err := scanJob(tx.QueryRowContext(ctx, q.rebind(query), StatusQueued, StatusRunning, now))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, q.rebind(
+		`update jobs set status = ?, attempts = attempts + 1, locked_at = ?, run_at = ? where id = ?`),
+		StatusRunning, now, now.Add(q.opts.Timeout+time.Minute), job.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	job.Status = StatusRunning
+	job.Attempts++
+	return job, nil
+}
+
+// run runs job and records the outcome: finished jobs are deleted, failed
+// ones are retried later or, out of attempts, marked dead
+func (q *Queue) run(ctx context.Context, job *Job) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "job "+job.Type,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.Int64("job.id", job.ID),
+			attribute.String("job.type", job.Type),
+			attribute.Int("job.attempt", job.Attempts),
+		))
+	logger := slog.Default().With("job_id", job.ID, "job_type", job.Type, "attempt", job.Attempts)
+	if span.SpanContext().IsValid() {
+		logger = logger.With("trace_id", span.SpanContext().TraceID().String())
+	}
+	ctx = logging.NewContext(ctx, logger)
+
+	var err error
+	if job.Attempts > job.MaxAttempts {
+		// claimed again after its worker died on the last attempt
+		err = Permanent(errors.New("abandoned by its worker"))
+	} else {
+		err = q.call(ctx, job)
+	}
+
+	outcome, next := "success", time.Time{}
+	switch {
+	case err == nil:
+		_, err = q.db.ExecContext(context.WithoutCancel(ctx), q.rebind(`delete from jobs where id = ?`), job.ID)
+		if err != nil {
+			logger.Error("deleting finished job", "error", err)
+		}
+		err = nil
+	case errors.Is(context.Cause(ctx), errStopped):
+		outcome = "interrupted"
+		q.finish(ctx, job, StatusQueued, -1, q.now(), err)
+	case job.Attempts >= job.MaxAttempts || isPermanent(err):
+		outcome = "dead"
+		q.finish(ctx, job, StatusDead, 0, q.now(), err)
+	default:
+		outcome = "retry"
+		next = q.now().Add(q.opts.Backoff(job.Attempts))
+		q.finish(ctx, job, StatusQueued, 0, next, err)
+	}
+
+	duration := time.Since(start)
+	metrics.JobRuns.WithLabelValues(job.Type, outcome).Inc()
+	metrics.JobDuration.WithLabelValues(job.Type).Observe(duration.Seconds())
+	span.SetAttributes(attribute.String("job.outcome", outcome))
+	tracing.End(span, err)
+
+	attrs := []interface{}{"outcome", outcome, "duration_ms", float64(duration.Microseconds()) / 1000}
+	switch outcome {
+	case "success":
+		logger.Info("job finished", attrs...)
+	case "retry":
+		logger.Warn("job failed", append(attrs, "error", err, "retry_at", next)...)
+	case "dead":
+		logger.Error("job failed", append(attrs, "error", err)...)
+	default:
+		logger.Warn("job interrupted", attrs...)
+	}
+}
+
+// call runs the handler of job within its timeout, turning a panic into an
+// error
+func (q *Queue) call(ctx context.Context, job *Job) (err error) {
+	h, ok := q.handlers[job.Type]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownType, job.Type)
+	}
+	ctx, cancel := context.WithTimeout(ctx, q.opts.Timeout)
+	defer cancel()
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v\n%s", v, debug.Stack())
+		}
+	}()
+	return h(ctx, job)
+}
+
+// finish moves a job that didn't succeed to status, giving back attempts
+// when it was only interrupted
+func (q *Queue) finish(ctx context.Context, job *Job, status string, attempts int, runAt time.Time, cause error) {
+	lastError := ""
+	if cause != nil {
+		lastError = cause.Error()
+	}
+	_, err := q.db.ExecContext(context.WithoutCancel(ctx), q.rebind(
+		`update jobs set status = ?, attempts = attempts + ?, run_at = ?, locked_at = null, last_error = ? where id = ?`),
+		status, attempts, runAt, lastError, job.ID)
+	if err != nil {
+		logging.FromContext(ctx).Error("updating failed job", "error", err)
+	}
+}
+
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// hook is a function run when the application starts or stops
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// OnStartup registers fn to run, in registration order, before the server
+// starts accepting connections. An error aborts the start.
+func (a *application) OnStartup(name string, fn func(ctx context.Context) error) {
+	a.startupHooks = append(a.startupHooks, hook{name: name, fn: fn})
+}
+
+// OnShutdown registers fn to run once the server has drained its requests.
+// Hooks run in reverse registration order, so whatever was set up first,
+// like the database pool, is torn down last.
+func (a *application) OnShutdown(name string, fn func(ctx context.Context) error) {
+	a.shutdownHooks = append(a.shutdownHooks, hook{name: name, fn: fn})
+}
+
+// registerDefaultHooks closes what scotch opened for us when the app stops
+func (a *application) registerDefaultHooks() {
+	a.OnShutdown("database", func(ctx context.Context) error {
+		if a.App.DB.Pool == nil {
+			return nil
+		}
+		return a.App.DB.Pool.Close()
+	})
+	a.OnShutdown("redis", func(ctx context.Context) error {
+		if a.Redis == nil {
+			return nil
+		}
+		return a.Redis.Close()
+	})
+	a.OnShutdown("sessions", func(ctx context.Context) error {
+		// the postgres, mysql and sqlite stores run a cleanup goroutine
+		if s, ok := a.App.Session.Store.(interface{ StopCleanup() }); ok {
+			s.StopCleanup()
+		}
+		return nil
+	})
+}
+
+// serve runs the web server until it fails or the process receives SIGINT or
+// SIGTERM, then stops accepting connections and waits for in flight requests
+// for at most SHUTDOWN_TIMEOUT seconds. The shutdown hooks are left to the
+// caller, since every command needs them and not only serve.
+func (a *application) serve() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, h := range a.startupHooks {
+		if err := h.fn(ctx); err != nil {
+			return fmt.Errorf("startup hook %s: %w", h.name, err)
+		}
+	}
+
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", a.Config.Port),
+		ErrorLog:     a.App.ErrorLog,
+		Handler:      a.Middleware.Tracing(a.App.Routes),
+		IdleTimeout:  30 * time.Second,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 600 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "port", a.Config.Port)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	var errs []error
+	select {
+	case err := <-serveErr:
+		errs = append(errs, err)
+	case <-ctx.Done():
+		slog.Info("shutting down", "timeout", a.Config.ShutdownTimeoutDuration().String())
+	}
+	// a second signal kills the process instead of waiting for the drain
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.Config.ShutdownTimeoutDuration())
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("draining requests: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// shutdown runs every shutdown hook, even when an earlier one fails
+func (a *application) shutdown(ctx context.Context) error {
+	var errs []error
+	for i := len(a.shutdownHooks) - 1; i >= 0; i-- {
+		h := a.shutdownHooks[i]
+		if err := h.fn(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown hook %s: %w", h.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
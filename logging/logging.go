@@ -0,0 +1,93 @@
+// Package logging builds the application's structured logger and carries a
+// request scoped copy of it through the context.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+)
+
+type contextKey struct{}
+
+// New returns a logger writing json lines, or human readable text at debug
+// level when debug is set
+func New(w io.Writer, debug bool) *slog.Logger {
+	if debug {
+		return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelInfo}))
+}
+
+// NewContext returns a copy of ctx carrying l
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx, or the default logger when
+// there is none, so callers never have to check for nil
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+			return l
+		}
+	}
+	return slog.Default()
+}
+
+// Request describes the request a logger belongs to. Route and UserID are
+// called every time a line is written, since neither is known when the
+// request starts: chi fills in the route pattern while routing and the user
+// may log in or out during the request.
+type Request struct {
+	ID string
+	// TraceID links the log lines to the trace of the request, if any
+	TraceID string
+	Start   time.Time
+	Route   func() string
+	UserID  func() int
+}
+
+// ForRequest returns a logger adding the request id, route, user id and the
+// latency so far to every line written through it
+func ForRequest(l *slog.Logger, req *Request) *slog.Logger {
+	return slog.New(&requestHandler{handler: l.Handler(), req: req})
+}
+
+type requestHandler struct {
+	handler slog.Handler
+	req     *Request
+}
+
+func (h *requestHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *requestHandler) Handle(ctx context.Context, r slog.Record) error {
+	r = r.Clone()
+	r.AddAttrs(slog.String("request_id", h.req.ID))
+	if h.req.TraceID != "" {
+		r.AddAttrs(slog.String("trace_id", h.req.TraceID))
+	}
+	if h.req.Route != nil {
+		if route := h.req.Route(); route != "" {
+			r.AddAttrs(slog.String("route", route))
+		}
+	}
+	if h.req.UserID != nil {
+		if id := h.req.UserID(); id != 0 {
+			r.AddAttrs(slog.Int("user_id", id))
+		}
+	}
+	r.AddAttrs(slog.Float64("latency_ms", float64(time.Since(h.req.Start).Microseconds())/1000))
+	return h.handler.Handle(ctx, r)
+}
+
+func (h *requestHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &requestHandler{handler: h.handler.WithAttrs(attrs), req: h.req}
+}
+
+func (h *requestHandler) WithGroup(name string) slog.Handler {
+	return &requestHandler{handler: h.handler.WithGroup(name), req: h.req}
+}
@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf, false).Debug("hidden")
+	New(&buf, false).Info("hello", "n", 1)
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected a single json line, got %q: %s", buf.String(), err)
+	}
+	if line["msg"] != "hello" || line["n"] != float64(1) {
+		t.Errorf("unexpected line %v", line)
+	}
+
+	buf.Reset()
+	New(&buf, true).Debug("shown")
+	if !strings.Contains(buf.String(), "level=DEBUG msg=shown") {
+		t.Errorf("expected a text debug line, got %q", buf.String())
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, false)
+	if FromContext(context.Background()) == l {
+		t.Error("expected the default logger for an empty context")
+	}
+	if FromContext(NewContext(context.Background(), l)) != l {
+		t.Error("expected the logger stored in the context")
+	}
+}
+
+func TestForRequest(t *testing.T) {
+	var buf bytes.Buffer
+	route, userID := "", 0
+	l := ForRequest(New(&buf, false), &Request{
+		ID:     "abc",
+		Start:  time.Now(),
+		Route:  func() string { return route },
+		UserID: func() int { return userID },
+	})
+
+	l.Info("before")
+	route, userID = "/users/{id}", 7
+	l.With("k", "v").Info("after")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+
+	var before, after map[string]interface{}
+	_ = json.Unmarshal([]byte(lines[0]), &before)
+	_ = json.Unmarshal([]byte(lines[1]), &after)
+
+	if before["request_id"] != "abc" {
+		t.Errorf("expected the request id, got %v", before)
+	}
+	if _, ok := before["route"]; ok {
+		t.Errorf("expected no route before routing, got %v", before)
+	}
+	if _, ok := before["latency_ms"]; !ok {
+		t.Errorf("expected the latency, got %v", before)
+	}
+	if after["route"] != "/users/{id}" || after["user_id"] != float64(7) || after["k"] != "v" {
+		t.Errorf("expected route, user id and attrs, got %v", after)
+	}
+}
@@ -1,20 +1,67 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/gomodule/redigo/redis"
 	"github.com/prateekjoshi2013/scotch"
+	"github.com/prateekjoshi2013/scotch-primer/assets"
+	"github.com/prateekjoshi2013/scotch-primer/config"
 	"github.com/prateekjoshi2013/scotch-primer/data"
 	"github.com/prateekjoshi2013/scotch-primer/handlers"
+	"github.com/prateekjoshi2013/scotch-primer/health"
+	"github.com/prateekjoshi2013/scotch-primer/jobs"
 	"github.com/prateekjoshi2013/scotch-primer/middlewares"
+	"github.com/prateekjoshi2013/scotch-primer/scheduler"
 )
 
 type application struct {
 	App        *scotch.Scotch
+	Config     *config.Config
 	Handlers   *handlers.Handlers
 	Models     data.Models
 	Middleware *middlewares.Middleware
+	Health     *health.Checker
+	Redis      *redis.Pool
+	// Assets are the static assets served under /public
+	Assets *assets.Assets
+	// RateLimits keeps the counters of the rate limits
+	RateLimits middlewares.RateLimitStore
+	// Jobs is nil when there is no database
+	Jobs *jobs.Queue
+	// Scheduler is nil when there is no database
+	Scheduler *scheduler.Scheduler
+
+	startupHooks  []hook
+	shutdownHooks []hook
 }
 
 func main() {
+	cmd, out, args, err := parseCommand(os.Args[1:])
+	if err != nil {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
 	s := initApplication()
-	s.App.ListenAndServe()
+	err = cmd(s, out, args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Config.ShutdownTimeoutDuration())
+	if hookErr := s.shutdown(ctx); hookErr != nil {
+		slog.Error("shutting down", "error", hookErr)
+	}
+	cancel()
+
+	if errors.Is(err, errUsage) {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		slog.Error("command failed", "error", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/prateekjoshi2013/scotch-primer/data"
+	"github.com/prateekjoshi2013/scotch-primer/logging"
+	"github.com/prateekjoshi2013/scotch-primer/scheduler"
+)
+
+// rememberTokenLifetime is how long the remember me cookie lasts; older
+// remember tokens can't be presented any more
+const rememberTokenLifetime = 365 * 24 * time.Hour
+
+// deletedUserRetention is how long deleted users are kept, hidden, before
+// they are purged for good
+const deletedUserRetention = 30 * 24 * time.Hour
+
+// registerMaintenance schedules the tasks that delete expired rows, which
+// lookups otherwise only filter out. The schedule only runs with serve;
+// scotchApp tasks run starts a task by hand.
+func (a *application) registerMaintenance() {
+	a.Scheduler = scheduler.New(scheduler.NewLocker(a.App.DB.Pool, a.Config.Database.Type))
+	add := func(name, schedule string, task scheduler.Task) {
+		if err := a.Scheduler.Add(name, schedule, task); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	add("purge-expired-tokens", "@hourly", func(ctx context.Context) error {
+		n, err := a.Models.Tokens.DeleteExpired(ctx, time.Now())
+		logging.FromContext(ctx).Info("purged expired tokens", "deleted", n)
+		return err
+	})
+	add("purge-remember-tokens", "@daily", func(ctx context.Context) error {
+		n, err := a.Models.RememberTokens.DeleteCreatedBefore(ctx, time.Now().Add(-rememberTokenLifetime))
+		logging.FromContext(ctx).Info("purged remember tokens", "deleted", n)
+		return err
+	})
+	add("purge-deleted-users", "@daily", func(ctx context.Context) error {
+		n, err := a.Models.Users.PurgeDeleted(ctx, time.Now().Add(-deletedUserRetention))
+		logging.FromContext(ctx).Info("purged deleted users", "deleted", n)
+		return err
+	})
+	switch a.Config.SessionType {
+	case "postgres", "postgresql", "mysql", "mariadb", "sqlite":
+		// the scs stores clean up too, but only while the instance that
+		// started the cleanup runs, and every instance scans the table
+		add("purge-expired-sessions", "*/30 * * * *", func(ctx context.Context) error {
+			n, err := data.PurgeSessions(ctx)
+			logging.FromContext(ctx).Info("purged expired sessions", "deleted", n)
+			return err
+		})
+	}
+
+	if a.Config.Scheduler.Enabled {
+		a.OnStartup("scheduler", a.Scheduler.Start)
+	}
+	a.OnShutdown("scheduler", a.Scheduler.Stop)
+}
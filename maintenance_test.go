@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prateekjoshi2013/scotch"
+	"github.com/prateekjoshi2013/scotch-primer/config"
+	"github.com/prateekjoshi2013/scotch-primer/data"
+	"github.com/prateekjoshi2013/scotch-primer/migrations"
+)
+
+func TestMaintenance_PurgeDeletedUsers(t *testing.T) {
+	t.Setenv("DATABASE_TYPE", "sqlite")
+	pool, err := data.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Close() })
+	runner, err := migrations.New(pool, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &application{
+		App:    &scotch.Scotch{DB: scotch.Database{DataType: "sqlite", Pool: pool}},
+		Config: &config.Config{SessionType: "cookie", Database: config.Database{Type: "sqlite"}},
+		Models: data.New(pool),
+	}
+	a.registerMaintenance()
+
+	var ids []int
+	for _, email := range []string{"old@example.com", "recent@example.com", "kept@example.com"} {
+		id, err := a.Models.Users.Insert(data.User{FirstName: "Ada", LastName: "Lovelace", Email: email, Active: 1, Password: "password"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	for _, id := range ids[:2] {
+		if err := a.Models.Users.Delete(id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.Models.Users.Get(id); !errors.Is(err, data.ErrNotFound) {
+			t.Errorf("expected a deleted user not to be found, got %v", err)
+		}
+	}
+	// deleted before the retention
+	old := time.Now().Add(-deletedUserRetention - time.Hour)
+	if _, err := pool.Exec("update users set deleted_at = ? where id = ?", old, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Scheduler.Run(context.Background(), "purge-deleted-users"); err != nil {
+		t.Fatal(err)
+	}
+	var left []int
+	rows, err := pool.Query("select id from users order by id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		left = append(left, id)
+	}
+	if len(left) != 2 || left[0] != ids[1] || left[1] != ids[2] {
+		t.Errorf("expected only the user deleted before the retention to be purged, left %v of %v", left, ids)
+	}
+}
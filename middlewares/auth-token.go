@@ -1,10 +1,20 @@
 package middlewares
 
-import "net/http"
+import (
+	"context"
+	"net/http"
 
+	"github.com/prateekjoshi2013/scotch-primer/data"
+	"github.com/prateekjoshi2013/scotch-primer/logging"
+)
+
+type tokenUserKey struct{}
+
+// AuthToken refuses the requests without a valid bearer token, and gives
+// the handlers the user of the token through TokenUser
 func (m *Middleware) AuthToken(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, err := m.Models.Tokens.Authenticate(r)
+		user, err := m.Models.Tokens.Authenticate(r)
 		if err != nil {
 			var payload struct {
 				Error   bool   `json:"error"`
@@ -12,7 +22,24 @@ func (m *Middleware) AuthToken(next http.Handler) http.Handler {
 			}
 			payload.Error = true
 			payload.Message = "invalid auth credentials"
-			_ = m.App.WriteJSON(w, http.StatusUnauthorized, payload)
+			status := data.HTTPStatus(err)
+			switch status {
+			case http.StatusNotFound:
+				// an unknown token is just bad credentials
+				status = http.StatusUnauthorized
+			case http.StatusInternalServerError:
+				logging.FromContext(r.Context()).Error("authenticating token", "error", err)
+				payload.Message = http.StatusText(status)
+			}
+			_ = m.App.WriteJSON(w, status, payload)
+			return
 		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenUserKey{}, user)))
 	})
 }
+
+// TokenUser returns the user AuthToken authenticated the request as, or nil
+func TokenUser(ctx context.Context) *data.User {
+	user, _ := ctx.Value(tokenUserKey{}).(*data.User)
+	return user
+}
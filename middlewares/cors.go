@@ -0,0 +1,141 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prateekjoshi2013/scotch-primer/logging"
+)
+
+// CORSOptions are the cross origin requests the api accepts
+type CORSOptions struct {
+	// AllowedOrigins are scheme://host[:port] origins; * allows any origin,
+	// and a * in the host matches one or more labels, as in
+	// https://*.example.com
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders are the request headers clients may send; * allows any
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how many seconds browsers may cache a preflight response
+	MaxAge int
+}
+
+// CORS lets the browsers of the allowed origins call the api. Preflight
+// requests are answered here without reaching the routes; other requests
+// from an origin that isn't allowed are served without the CORS headers, so
+// the browser hides the response from the calling script.
+func (m *Middleware) CORS(opts CORSOptions) func(http.Handler) http.Handler {
+	methods := strings.Join(opts.AllowedMethods, ", ")
+	exposed := strings.Join(opts.ExposedHeaders, ", ")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			logger := logging.FromContext(r.Context())
+			if !opts.allowsOrigin(origin) {
+				logger.Debug("cors origin rejected", "origin", origin)
+				if preflight {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowOrigin := origin
+			if opts.allowsAnyOrigin() && !opts.AllowCredentials {
+				allowOrigin = "*"
+			}
+			if !preflight {
+				h.Set("Access-Control-Allow-Origin", allowOrigin)
+				if opts.AllowCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+				if exposed != "" {
+					h.Set("Access-Control-Expose-Headers", exposed)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			method := r.Header.Get("Access-Control-Request-Method")
+			headers := r.Header.Get("Access-Control-Request-Headers")
+			if !contains(opts.AllowedMethods, method) || !opts.allowsHeaders(headers) {
+				logger.Debug("cors preflight rejected", "origin", origin, "method", method, "headers", headers)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			h.Set("Access-Control-Allow-Origin", allowOrigin)
+			if opts.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			h.Set("Access-Control-Allow-Methods", methods)
+			if headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			}
+			if opts.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(opts.MaxAge))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+func (o CORSOptions) allowsAnyOrigin() bool {
+	return contains(o.AllowedOrigins, "*")
+}
+
+func (o CORSOptions) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range o.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		prefix, suffix, wildcard := strings.Cut(allowed, "*")
+		if wildcard && len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders reports whether every header of the comma separated list
+// requested may be sent
+func (o CORSOptions) allowsHeaders(requested string) bool {
+	if contains(o.AllowedHeaders, "*") {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		if header = strings.TrimSpace(header); header != "" && !contains(o.AllowedHeaders, header) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains reports whether list holds s, ignoring case
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
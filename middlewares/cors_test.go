@@ -0,0 +1,98 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	m := &Middleware{}
+	reached := false
+	h := m.CORS(CORSOptions{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	serve := func(method, origin string, header map[string]string) *httptest.ResponseRecorder {
+		reached = false
+		r := httptest.NewRequest(method, "/api/me", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr
+	}
+	preflight := func(origin, method, headers string) *httptest.ResponseRecorder {
+		return serve("OPTIONS", origin, map[string]string{
+			"Access-Control-Request-Method":  method,
+			"Access-Control-Request-Headers": headers,
+		})
+	}
+
+	rr := preflight("https://app.example.com", "POST", "authorization, content-type")
+	if rr.Code != http.StatusNoContent || reached {
+		t.Fatalf("expected the preflight to be answered, got %d", rr.Code)
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST",
+		"Access-Control-Allow-Headers":     "authorization, content-type",
+		"Access-Control-Max-Age":           "600",
+	}
+	for k, v := range want {
+		if got := rr.Header().Get(k); got != v {
+			t.Errorf("%s: expected %q, got %q", k, v, got)
+		}
+	}
+
+	for _, tt := range []struct{ name, origin, method, headers string }{
+		{"unknown origin", "https://evil.example.com", "POST", ""},
+		{"wildcard without a label", "https://.example.org", "GET", ""},
+		{"method", "https://app.example.com", "DELETE", ""},
+		{"header", "https://app.example.com", "GET", "X-Secret"},
+	} {
+		rr := preflight(tt.origin, tt.method, tt.headers)
+		if rr.Code != http.StatusForbidden || rr.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: expected the preflight to be refused, got %d %v", tt.name, rr.Code, rr.Header())
+		}
+	}
+
+	rr = serve("GET", "https://api.eu.example.org", nil)
+	if !reached || rr.Header().Get("Access-Control-Allow-Origin") != "https://api.eu.example.org" ||
+		rr.Header().Get("Access-Control-Expose-Headers") != "X-Request-ID" {
+		t.Errorf("expected a wildcard origin to be allowed, got %v", rr.Header())
+	}
+	rr = serve("GET", "https://evil.example.com", nil)
+	if !reached || rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected the request to be served without cors headers, got %v", rr.Header())
+	}
+	rr = serve("OPTIONS", "", nil)
+	if !reached || rr.Header().Get("Vary") != "Origin" {
+		t.Errorf("expected a same origin request to pass through, got %v", rr.Header())
+	}
+}
+
+func TestCORS_AnyOrigin(t *testing.T) {
+	m := &Middleware{}
+	h := m.CORS(CORSOptions{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest("GET", "/api/me", nil)
+	r.Header.Set("Origin", "https://anywhere.test")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("expected *, got %q", got)
+	}
+}
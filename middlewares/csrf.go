@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/justinas/nosurf"
+)
+
+// CSRF checks that the unsafe requests carry the token of their session in
+// the csrf_token form field or the X-CSRF-Token header; the handlers render
+// it into the templates as .CSRFToken. Scripts, such as the ones posting
+// json, take it for the header from the csrf-token meta tag of the base
+// layout. Refused requests are answered by failure.
+//
+// Api requests with a bearer token are exempt: browsers never attach the
+// Authorization header on their own, so they can't be forged that way.
+func (m *Middleware) CSRF(secure bool, domain string, failure http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		csrf := nosurf.New(next)
+		csrf.SetBaseCookie(http.Cookie{
+			Path:     "/",
+			Domain:   domain,
+			Secure:   secure,
+			HttpOnly: true,
+			// lax rather than strict, so that following a link to the app
+			// from elsewhere doesn't replace the token of an open form
+			SameSite: http.SameSiteLaxMode,
+			MaxAge:   nosurf.MaxAge,
+		})
+		csrf.ExemptFunc(bearerAPIRequest)
+		csrf.SetFailureHandler(failure)
+		return csrf
+	}
+}
+
+func bearerAPIRequest(r *http.Request) bool {
+	if r.URL.Path != "/api" && !strings.HasPrefix(r.URL.Path, "/api/") {
+		return false
+	}
+	return strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
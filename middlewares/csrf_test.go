@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/justinas/nosurf"
+)
+
+func TestCSRF(t *testing.T) {
+	m := &Middleware{}
+	var token string
+	failure := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "refused", http.StatusForbidden)
+	})
+	h := m.CSRF(true, "example.com", failure)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = nosurf.Token(r)
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/form", nil))
+	cookies := rr.Result().Cookies()
+	if token == "" || len(cookies) != 1 {
+		t.Fatalf("expected a token and its cookie, got %q and %v", token, cookies)
+	}
+	c := cookies[0]
+	if !c.Secure || !c.HttpOnly || c.Domain != "example.com" || c.SameSite != http.SameSiteLaxMode {
+		t.Errorf("expected the cookie settings to be applied, got %+v", c)
+	}
+
+	post := func(path string, form url.Values, header http.Header) int {
+		r := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		r.AddCookie(c)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr.Code
+	}
+	bearer := http.Header{"Authorization": {"Bearer abc"}}
+
+	tests := []struct {
+		name   string
+		path   string
+		form   url.Values
+		header http.Header
+		status int
+	}{
+		{"no token", "/form", nil, nil, http.StatusForbidden},
+		{"wrong token", "/form", url.Values{"csrf_token": {"nope"}}, nil, http.StatusForbidden},
+		{"form token", "/form", url.Values{"csrf_token": {token}}, nil, http.StatusOK},
+		{"header token", "/form", nil, http.Header{"X-Csrf-Token": {token}}, http.StatusOK},
+		{"bearer api", "/api/users", nil, bearer, http.StatusOK},
+		{"api without bearer", "/api/users", nil, nil, http.StatusForbidden},
+		{"bearer outside the api", "/form", nil, bearer, http.StatusForbidden},
+		{"json without token", "/form", nil, http.Header{"Content-Type": {"application/json"}}, http.StatusForbidden},
+		{"json header token", "/form", nil, http.Header{"Content-Type": {"application/json"}, "X-Csrf-Token": {token}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if status := post(tt.path, tt.form, tt.header); status != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.status, status)
+		}
+	}
+}
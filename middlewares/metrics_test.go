@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prateekjoshi2013/scotch-primer/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware_Metrics(t *testing.T) {
+	m := &Middleware{}
+	mux := chi.NewRouter()
+	mux.Use(m.Metrics)
+	mux.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+
+	for _, path := range []string{"/users/1", "/users/2", "/nowhere"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	if n := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", "/users/{id}", "200")); n != 2 {
+		t.Errorf("expected 2 requests labelled by route pattern, got %v", n)
+	}
+	if n := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", "unmatched", "404")); n != 1 {
+		t.Errorf("expected 1 unmatched request, got %v", n)
+	}
+}
+
+func TestMetricsHandler_Token(t *testing.T) {
+	h := metrics.Handler("secret")
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 with the token, got %d", rr.Code)
+	}
+}
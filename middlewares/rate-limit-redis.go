@@ -0,0 +1,109 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// RedisRateLimitStore keeps the counters in redis, shared by every instance
+// of the app. Each count is one script, so concurrent requests can't both
+// take the last token.
+type RedisRateLimitStore struct {
+	pool   *redis.Pool
+	prefix string
+	now    func() time.Time
+}
+
+// NewRedisRateLimitStore returns a store keeping its counters under
+// prefix:ratelimit:
+func NewRedisRateLimitStore(pool *redis.Pool, prefix string) *RedisRateLimitStore {
+	if prefix != "" {
+		prefix += ":"
+	}
+	return &RedisRateLimitStore{pool: pool, prefix: prefix + "ratelimit:", now: time.Now}
+}
+
+// tokenBucketScript refills and takes from the bucket in KEYS[1]; ARGV are
+// the limit, the period and the time, in milliseconds
+var tokenBucketScript = redis.NewScript(1, `
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1]) or limit
+local last = tonumber(state[2]) or now
+tokens = math.min(limit, tokens + math.max(0, now - last) * limit / period)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('PEXPIRE', KEYS[1], period)
+return {allowed, tostring(tokens)}
+`)
+
+// slidingWindowScript counts the request in the current window, KEYS[1], if
+// the estimate with the previous one, KEYS[2], allows it; ARGV are the
+// limit, the weight of the previous window and the ttl of the counters
+var slidingWindowScript = redis.NewScript(2, `
+local limit = tonumber(ARGV[1])
+local weight = tonumber(ARGV[2])
+local prev = tonumber(redis.call('GET', KEYS[2]) or '0')
+local curr = tonumber(redis.call('GET', KEYS[1]) or '0')
+if prev * weight + curr + 1 > limit then
+	return {0, prev, curr}
+end
+curr = redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return {1, prev, curr}
+`)
+
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, policy RateLimitPolicy) (RateLimitResult, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	defer conn.Close()
+	key = s.prefix + key
+	now := s.now()
+
+	switch policy.Algorithm {
+	case TokenBucket:
+		reply, err := redis.Values(tokenBucketScript.DoContext(ctx, conn,
+			key, policy.Limit, policy.Period.Milliseconds(), now.UnixMilli()))
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+		var allowed int
+		var tokens string
+		if _, err := redis.Scan(reply, &allowed, &tokens); err != nil {
+			return RateLimitResult{}, err
+		}
+		left, err := strconv.ParseFloat(tokens, 64)
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+		return bucketResult(left, allowed == 1, policy), nil
+
+	case SlidingWindow:
+		window, elapsed := windowOf(now, policy.Period)
+		weight := strconv.FormatFloat(windowWeight(elapsed, policy.Period), 'f', -1, 64)
+		reply, err := redis.Values(slidingWindowScript.DoContext(ctx, conn,
+			fmt.Sprintf("%s:%d", key, window), fmt.Sprintf("%s:%d", key, window-1),
+			policy.Limit, weight, (2 * policy.Period).Milliseconds()))
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+		var allowed, prev, curr int
+		if _, err := redis.Scan(reply, &allowed, &prev, &curr); err != nil {
+			return RateLimitResult{}, err
+		}
+		return windowResult(prev, curr, elapsed, allowed == 1, policy), nil
+	}
+	return RateLimitResult{}, fmt.Errorf("unknown rate limit algorithm %d", policy.Algorithm)
+}
@@ -0,0 +1,163 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimitStore keeps the counters of the RateLimit middleware
+type RateLimitStore interface {
+	// Take counts a request against key under policy
+	Take(ctx context.Context, key string, policy RateLimitPolicy) (RateLimitResult, error)
+}
+
+// MemoryRateLimitStore keeps the counters in the process, so each instance
+// of the app has limits of its own
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	entries   map[string]*limitEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type limitEntry struct {
+	// token bucket
+	tokens float64
+	last   time.Time
+	// sliding window
+	window     int64
+	prev, curr int
+
+	expires time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{entries: make(map[string]*limitEntry), now: time.Now}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, policy RateLimitPolicy) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &limitEntry{tokens: float64(policy.Limit), last: now}
+		s.entries[key] = e
+	}
+	switch policy.Algorithm {
+	case TokenBucket:
+		tokens, allowed := takeToken(e.tokens, now.Sub(e.last), policy)
+		e.tokens, e.last = tokens, now
+		e.expires = now.Add(policy.Period)
+		return bucketResult(tokens, allowed, policy), nil
+	case SlidingWindow:
+		window, elapsed := windowOf(now, policy.Period)
+		switch {
+		case e.window == window-1:
+			e.prev, e.curr = e.curr, 0
+		case e.window != window:
+			e.prev, e.curr = 0, 0
+		}
+		e.window = window
+		allowed := windowAllows(e.prev, e.curr, elapsed, policy)
+		if allowed {
+			e.curr++
+		}
+		e.expires = now.Add(2 * policy.Period)
+		return windowResult(e.prev, e.curr, elapsed, allowed, policy), nil
+	}
+	return RateLimitResult{}, fmt.Errorf("unknown rate limit algorithm %d", policy.Algorithm)
+}
+
+// sweep drops the counters that are back to their initial state, at most
+// once a minute
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// takeToken refills a bucket holding tokens after elapsed, and takes a token
+// from it if there is one
+func takeToken(tokens float64, elapsed time.Duration, policy RateLimitPolicy) (float64, bool) {
+	rate := float64(policy.Limit) / policy.Period.Seconds()
+	tokens = math.Min(float64(policy.Limit), tokens+math.Max(0, elapsed.Seconds())*rate)
+	if tokens < 1 {
+		return tokens, false
+	}
+	return tokens - 1, true
+}
+
+// bucketResult describes a bucket left holding tokens
+func bucketResult(tokens float64, allowed bool, policy RateLimitPolicy) RateLimitResult {
+	rate := float64(policy.Limit) / policy.Period.Seconds()
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Limit:     policy.Limit,
+		Remaining: int(tokens),
+		Reset:     time.Duration((float64(policy.Limit) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return result
+}
+
+// windowOf returns the fixed window now falls in, and how far into it now is
+func windowOf(now time.Time, period time.Duration) (int64, time.Duration) {
+	ms := now.UnixMilli()
+	size := period.Milliseconds()
+	return ms / size, time.Duration(ms%size) * time.Millisecond
+}
+
+// windowWeight is the part of the previous window still inside the sliding
+// window, elapsed into the current one
+func windowWeight(elapsed, period time.Duration) float64 {
+	return 1 - float64(elapsed)/float64(period)
+}
+
+func windowAllows(prev, curr int, elapsed time.Duration, policy RateLimitPolicy) bool {
+	return float64(prev)*windowWeight(elapsed, policy.Period)+float64(curr)+1 <= float64(policy.Limit)
+}
+
+// windowResult describes the sliding window, curr including the request
+// when it was allowed
+func windowResult(prev, curr int, elapsed time.Duration, allowed bool, policy RateLimitPolicy) RateLimitResult {
+	limit, period := float64(policy.Limit), policy.Period
+	used := float64(prev)*windowWeight(elapsed, period) + float64(curr)
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Limit:     policy.Limit,
+		Remaining: max(0, int(limit-used)),
+	}
+	// the quota is whole once the counted requests have slid out
+	switch {
+	case curr > 0:
+		result.Reset = 2*period - elapsed
+	case prev > 0:
+		result.Reset = period - elapsed
+	}
+	if allowed {
+		return result
+	}
+	if curr < policy.Limit {
+		// until enough of the previous window slides out
+		result.RetryAfter = time.Duration((1-(limit-float64(curr)-1)/float64(prev))*float64(period)) - elapsed
+	} else {
+		// until the next window, plus enough of this one sliding out
+		result.RetryAfter = period - elapsed + time.Duration((1-(limit-1)/float64(curr))*float64(period))
+	}
+	result.RetryAfter = max(0, result.RetryAfter)
+	return result
+}
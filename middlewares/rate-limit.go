@@ -0,0 +1,123 @@
+package middlewares
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prateekjoshi2013/scotch-primer/logging"
+	"github.com/prateekjoshi2013/scotch-primer/metrics"
+)
+
+// RateLimitAlgorithm is how a policy counts requests
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket allows bursts of Limit requests, then Limit per Period as
+	// the bucket refills
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow allows Limit requests in any Period, estimated from the
+	// counts of the current and previous fixed windows
+	SlidingWindow
+)
+
+// RateLimitPolicy is a limit of the RateLimit middleware
+type RateLimitPolicy struct {
+	// Name keeps the counters of policies apart, and labels the metrics
+	Name      string
+	Limit     int
+	Period    time.Duration
+	Algorithm RateLimitAlgorithm
+	// Key returns whose requests are counted together, see KeyByIP,
+	// KeyByUser and KeyByToken
+	Key func(r *http.Request) string
+}
+
+// RateLimitResult is the outcome of counting a request
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the quota is restored
+	Reset time.Duration
+	// RetryAfter is how long a refused client has to wait
+	RetryAfter time.Duration
+}
+
+// RateLimit refuses the requests over the limit of policy, counted in store,
+// with refused. Responses carry the RateLimit-Limit, RateLimit-Remaining,
+// RateLimit-Reset and RateLimit-Policy headers, and refusals Retry-After.
+// When the store fails the request is let through: an outage of redis
+// shouldn't take the app down with it.
+func (m *Middleware) RateLimit(store RateLimitStore, policy RateLimitPolicy, refused http.Handler) func(http.Handler) http.Handler {
+	policyHeader := fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Period.Seconds()))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := policy.Name + ":" + policy.Key(r)
+			result, err := store.Take(r.Context(), key, policy)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("rate limiting", "policy", policy.Name, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			// with several policies on a route, the closest to its limit is
+			// the one reported
+			if current, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err != nil || result.Remaining < current {
+				h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+				h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+				h.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+				h.Set("RateLimit-Policy", policyHeader)
+			}
+			if !result.Allowed {
+				metrics.RateLimited.WithLabelValues(policy.Name).Inc()
+				logging.FromContext(r.Context()).Info("rate limited", "policy", policy.Name)
+				h.Set("Retry-After", strconv.Itoa(max(1, seconds(result.RetryAfter))))
+				refused.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds rounds d up to whole seconds, as the headers want
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// KeyByIP counts requests by client address. Behind a proxy that is the
+// address of the proxy, unless RealIP trusts it.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// KeyByUser counts requests by logged in user, and by address before login
+func (m *Middleware) KeyByUser(r *http.Request) string {
+	if id := m.userID(r.Context()); id != 0 {
+		return "user:" + strconv.Itoa(id)
+	}
+	return KeyByIP(r)
+}
+
+// KeyByToken counts requests by bearer token, valid or not, and by address
+// without one. Tokens are hashed so they don't end up in redis.
+func KeyByToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return KeyByIP(r)
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,60 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		trusted        []string
+		remoteAddr     string
+		forwardedFor   []string
+		wantRemoteAddr string
+	}{
+		{"no trusted proxies", nil, "10.0.0.2:5123", []string{"203.0.113.7"}, "10.0.0.2:5123"},
+		{"untrusted peer", []string{"10.0.0.0/8"}, "198.51.100.9:5123", []string{"203.0.113.7"}, "198.51.100.9:5123"},
+		{"trusted proxy", []string{"10.0.0.0/8"}, "10.0.0.2:5123", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"spoofed hops", []string{"10.0.0.0/8"}, "10.0.0.2:5123", []string{"1.2.3.4, 203.0.113.7"}, "203.0.113.7"},
+		{"chain of proxies", []string{"10.0.0.2", "192.168.0.0/16"}, "10.0.0.2:5123",
+			[]string{"1.2.3.4", "203.0.113.7, 192.168.1.1"}, "203.0.113.7"},
+		{"garbled hop", []string{"10.0.0.0/8"}, "10.0.0.2:5123", []string{"unknown, 10.0.0.3"}, "10.0.0.3"},
+		{"without the header", []string{"10.0.0.0/8"}, "10.0.0.2:5123", nil, "10.0.0.2:5123"},
+		{"ipv6", []string{"2001:db8::/32"}, "[2001:db8::1]:5123", []string{"2001:db9::7"}, "2001:db9::7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := (&Middleware{}).RealIP(tt.trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.wantRemoteAddr {
+				t.Errorf("expected %q, got %q", tt.wantRemoteAddr, got)
+			}
+			if key := KeyByIP(r); tt.wantRemoteAddr == "203.0.113.7" && key != "ip:203.0.113.7" {
+				t.Errorf("expected the rate limits to count the client, got %q", key)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxy(t *testing.T) {
+	for _, s := range []string{"10.0.0.1", "10.0.0.0/8", "::1", "2001:db8::/32"} {
+		if _, err := ParseTrustedProxy(s); err != nil {
+			t.Errorf("expected %q to be accepted, got %v", s, err)
+		}
+	}
+	for _, s := range []string{"", "proxy.internal", "10.0.0.0/33"} {
+		if _, err := ParseTrustedProxy(s); err == nil {
+			t.Errorf("expected %q to be refused", s)
+		}
+	}
+}
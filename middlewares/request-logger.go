@@ -0,0 +1,106 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prateekjoshi2013/scotch-primer/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// RequestLogger gives every request an id, returned in the X-Request-ID
+// header, and puts a logger tagged with it in the request context for
+// handlers and models to use. It logs one line when the request completes.
+func (m *Middleware) RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := requestID(r)
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := r.Context()
+		var traceID string
+		if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+			traceID = sc.TraceID().String()
+		}
+		logger := logging.ForRequest(slog.Default(), &logging.Request{
+			ID:      id,
+			TraceID: traceID,
+			Start:   start,
+			Route: func() string {
+				if rctx := chi.RouteContext(ctx); rctx != nil {
+					return rctx.RoutePattern()
+				}
+				return ""
+			},
+			UserID: func() int { return m.userID(ctx) },
+		})
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(logging.NewContext(ctx, logger)))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		logger.Log(ctx, level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
+
+// requestID reuses the id set by a proxy or by chi's RequestID middleware,
+// and makes one up otherwise
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); id != "" && len(id) <= 128 && printable(id) {
+		return id
+	}
+	if id := middleware.GetReqID(r.Context()); id != "" {
+		return id
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func printable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x21 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// userID returns the id of the logged in user, or 0. Requests that never
+// went through the session middleware have no session to read, and scs
+// panics when asked for one.
+func (m *Middleware) userID(ctx context.Context) (id int) {
+	if m.App == nil || m.App.Session == nil {
+		return 0
+	}
+	defer func() {
+		if recover() != nil {
+			id = 0
+		}
+	}()
+	return m.App.Session.GetInt(ctx, "userID")
+}
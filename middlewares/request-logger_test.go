@@ -0,0 +1,66 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prateekjoshi2013/scotch-primer/logging"
+)
+
+func TestMiddleware_RequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logging.New(&buf, false))
+
+	m := &Middleware{}
+	mux := chi.NewRouter()
+	mux.Use(m.RequestLogger)
+	mux.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("in handler")
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("X-Request-ID", "from-proxy")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Header().Get("X-Request-ID") != "from-proxy" {
+		t.Errorf("expected the incoming request id to be echoed, got %q", rr.Header().Get("X-Request-ID"))
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a handler line and a request line, got %q", buf.String())
+	}
+	for _, l := range lines {
+		var line map[string]interface{}
+		if err := json.Unmarshal([]byte(l), &line); err != nil {
+			t.Fatal(err)
+		}
+		if line["request_id"] != "from-proxy" || line["route"] != "/users/{id}" {
+			t.Errorf("expected request id and route on every line, got %v", line)
+		}
+	}
+
+	var last map[string]interface{}
+	_ = json.Unmarshal([]byte(lines[1]), &last)
+	if last["status"] != float64(http.StatusTeapot) || last["level"] != "WARN" {
+		t.Errorf("expected a warning with the status, got %v", last)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "bad id\n")
+	id := requestID(req)
+	if id == "bad id\n" || len(id) != 16 {
+		t.Errorf("expected a generated id instead of an unprintable one, got %q", id)
+	}
+}
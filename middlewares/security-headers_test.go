@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	m := &Middleware{}
+	var nonces []string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonces = append(nonces, CSPNonce(r.Context()))
+	})
+
+	rr := httptest.NewRecorder()
+	m.SecurityHeaders(false)(next).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	rr2 := httptest.NewRecorder()
+	m.SecurityHeaders(true)(next).ServeHTTP(rr2, httptest.NewRequest("GET", "/", nil))
+
+	if len(nonces) != 2 || nonces[0] == "" || nonces[0] == nonces[1] {
+		t.Fatalf("expected a new nonce for every request, got %q", nonces)
+	}
+	csp := rr.Header().Get("Content-Security-Policy")
+	if !strings.Contains(csp, "script-src 'self' 'nonce-"+nonces[0]+"' https://cdn.jsdelivr.net") {
+		t.Errorf("expected the nonce in the script sources, got %q", csp)
+	}
+	if strings.Contains(csp, "unsafe-inline") || !strings.Contains(csp, "frame-ancestors 'none'") {
+		t.Errorf("expected a strict policy, got %q", csp)
+	}
+	for _, header := range []string{"X-Content-Type-Options", "X-Frame-Options", "Referrer-Policy", "Permissions-Policy"} {
+		if rr.Header().Get(header) == "" {
+			t.Errorf("expected %s to be set", header)
+		}
+	}
+
+	if hsts := rr.Header().Get("Strict-Transport-Security"); hsts != "" {
+		t.Errorf("expected no HSTS without SECURE, got %q", hsts)
+	}
+	if hsts := rr2.Header().Get("Strict-Transport-Security"); !strings.HasPrefix(hsts, "max-age=") {
+		t.Errorf("expected HSTS with SECURE, got %q", hsts)
+	}
+}
+
+func TestCSPNonce_WithoutMiddleware(t *testing.T) {
+	if nonce := CSPNonce(httptest.NewRequest("GET", "/", nil).Context()); nonce != "" {
+		t.Errorf("expected no nonce, got %q", nonce)
+	}
+}
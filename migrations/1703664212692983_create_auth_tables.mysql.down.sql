@@ -0,0 +1,3 @@
+drop table if exists tokens cascade;
+drop table if exists remember_tokens cascade;
+drop table if exists users cascade;
@@ -0,0 +1,3 @@
+drop table if exists tokens;
+drop table if exists remember_tokens;
+drop table if exists users;
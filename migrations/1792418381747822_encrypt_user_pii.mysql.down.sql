@@ -0,0 +1,5 @@
+-- the columns are left wide, since encrypted values no longer fit in the
+-- old ones
+DROP INDEX users_email_index_key ON users;
+
+ALTER TABLE users DROP COLUMN email_index;
@@ -0,0 +1,16 @@
+-- existing users keep their plain values and no blind index: they are still
+-- found by their plain email, and run scotchApp keys rotate once after
+-- upgrading to encrypt and index them
+-- ciphertexts are longer than the plain values, and uniqueness of emails is
+-- enforced on the blind index once they are encrypted
+ALTER TABLE users
+    MODIFY first_name varchar(512) NOT NULL,
+    MODIFY last_name varchar(512) NOT NULL,
+    MODIFY email varchar(512) NOT NULL,
+    ADD COLUMN email_index varchar(64) NULL;
+
+CREATE UNIQUE INDEX users_email_index_key ON users (email_index);
+
+ALTER TABLE tokens
+    MODIFY first_name varchar(512) NOT NULL,
+    MODIFY email varchar(512) NOT NULL;
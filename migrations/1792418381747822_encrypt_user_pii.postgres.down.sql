@@ -0,0 +1,5 @@
+-- the columns are left wide, since encrypted values no longer fit in the
+-- old ones
+DROP INDEX IF EXISTS users_email_index_key;
+
+ALTER TABLE users DROP COLUMN email_index;
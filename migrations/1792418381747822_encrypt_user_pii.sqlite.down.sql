@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_email_index_key;
+
+ALTER TABLE users DROP COLUMN email_index;
@@ -0,0 +1,7 @@
+-- existing users keep their plain values and no blind index: they are still
+-- found by their plain email, and run scotchApp keys rotate once after
+-- upgrading to encrypt and index them
+-- sqlite doesn't enforce varchar lengths, so only the blind index is needed
+ALTER TABLE users ADD COLUMN email_index varchar(64);
+
+CREATE UNIQUE INDEX users_email_index_key ON users (email_index);
@@ -0,0 +1,17 @@
+-- background jobs; workers claim due rows with SELECT ... FOR UPDATE SKIP
+-- LOCKED, which needs mysql 8 or mariadb 10.6
+CREATE TABLE jobs (
+    id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    type varchar(255) NOT NULL,
+    payload json NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'queued',
+    attempts int NOT NULL DEFAULT 0,
+    max_attempts int NOT NULL,
+    run_at datetime(6) NOT NULL,
+    locked_at datetime(6) NULL,
+    last_error text NULL,
+    created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE INDEX jobs_status_run_at_idx ON jobs (status, run_at);
@@ -0,0 +1,22 @@
+-- background jobs; workers claim due rows with SELECT ... FOR UPDATE SKIP
+-- LOCKED, and a job that fails on its last attempt stays behind as dead
+CREATE TABLE jobs (
+    id BIGSERIAL PRIMARY KEY,
+    type character varying(255) NOT NULL,
+    payload jsonb NOT NULL,
+    status character varying(16) NOT NULL DEFAULT 'queued',
+    attempts integer NOT NULL DEFAULT 0,
+    max_attempts integer NOT NULL,
+    run_at timestamp without time zone NOT NULL,
+    locked_at timestamp without time zone,
+    last_error text,
+    created_at timestamp without time zone NOT NULL DEFAULT now(),
+    updated_at timestamp without time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX jobs_status_run_at_idx ON jobs (status, run_at);
+
+CREATE TRIGGER set_timestamp
+    BEFORE UPDATE ON jobs
+    FOR EACH ROW
+    EXECUTE PROCEDURE trigger_set_timestamp();
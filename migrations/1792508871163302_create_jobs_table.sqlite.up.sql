@@ -0,0 +1,23 @@
+-- sqlite has a single writer, so claiming a job needs no row locks
+CREATE TABLE jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type varchar(255) NOT NULL,
+    payload text NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'queued',
+    attempts integer NOT NULL DEFAULT 0,
+    max_attempts integer NOT NULL,
+    run_at timestamp NOT NULL,
+    locked_at timestamp,
+    last_error text,
+    created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX jobs_status_run_at_idx ON jobs (status, run_at);
+
+CREATE TRIGGER jobs_set_timestamp
+    AFTER UPDATE ON jobs
+    FOR EACH ROW WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+    UPDATE jobs SET updated_at = CURRENT_TIMESTAMP WHERE id = OLD.id;
+END;
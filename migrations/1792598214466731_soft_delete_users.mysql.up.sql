@@ -0,0 +1,5 @@
+-- deleted users keep their row, hidden from every lookup, until the
+-- purge-deleted-users task removes it
+ALTER TABLE users ADD COLUMN deleted_at timestamp NULL DEFAULT NULL;
+
+CREATE INDEX users_deleted_at_idx ON users (deleted_at);
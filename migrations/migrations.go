@@ -0,0 +1,397 @@
+// Package migrations embeds the sql migration files of the application and
+// applies them to the configured database.
+//
+// Files are named <version>_<name>[.<dialect>].<up|down>.sql. A file with a
+// dialect (postgres, mysql, sqlite) is only used for that database type and
+// takes precedence over a dialect-less file of the same version.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// Table records the applied versions
+const Table = "schema_versions"
+
+var fileName = regexp.MustCompile(`^(\d+)_([^.]+)(?:\.([a-z]+))?\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	Dirty     bool       `json:"dirty"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+type Runner struct {
+	db         *sql.DB
+	dialect    string
+	fsys       fs.FS
+	migrations []Migration
+}
+
+// New returns a runner for the embedded migrations
+func New(db *sql.DB, databaseType string) (*Runner, error) {
+	return NewWithFS(db, databaseType, files)
+}
+
+// NewWithFS returns a runner for the migrations found at the root of fsys
+func NewWithFS(db *sql.DB, databaseType string, fsys fs.FS) (*Runner, error) {
+	r := &Runner{
+		db:      db,
+		dialect: Dialect(databaseType),
+		fsys:    fsys,
+	}
+	migrations, err := load(fsys, r.dialect)
+	if err != nil {
+		return nil, err
+	}
+	r.migrations = migrations
+	return r, nil
+}
+
+// Dialect normalises a DATABASE_TYPE value to the dialect used in file names
+func Dialect(databaseType string) string {
+	switch strings.ToLower(databaseType) {
+	case "mysql", "mariadb":
+		return "mysql"
+	case "postgres", "postgresql", "pgx", "":
+		return "postgres"
+	case "sqlite", "sqlite3":
+		return "sqlite"
+	default:
+		return strings.ToLower(databaseType)
+	}
+}
+
+func load(fsys fs.FS, dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	// dialect specific files win over generic ones, whatever order they are read in
+	specific := make(map[string]bool)
+	for _, entry := range entries {
+		m := fileName.FindStringSubmatch(entry.Name())
+		if m == nil || entry.IsDir() {
+			continue
+		}
+		if m[3] != "" && m[3] != dialect {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		key := m[1] + "." + m[4]
+		if specific[key] {
+			continue
+		}
+		if m[3] != "" {
+			specific[key] = true
+		}
+		if m[4] == "up" {
+			mig.up = entry.Name()
+		} else {
+			mig.down = entry.Name()
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file for %s", mig.Version, mig.Name, dialect)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrations returns the migrations available for the runner's dialect, oldest first
+func (r *Runner) Migrations() []Migration {
+	return r.migrations
+}
+
+// Up applies every pending migration and returns how many were applied
+func (r *Runner) Up() (int, error) {
+	applied, err := r.applied()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, mig := range r.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		if err := r.run(mig, mig.up); err != nil {
+			return count, err
+		}
+		_, err = r.db.Exec(r.bind("UPDATE "+Table+" SET dirty = ? WHERE version = ?"), false, mig.Version)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Down rolls back the last n applied migrations and returns how many were rolled back
+func (r *Runner) Down(n int) (int, error) {
+	applied, err := r.applied()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for i := len(r.migrations) - 1; i >= 0 && count < n; i-- {
+		mig := r.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.down == "" {
+			return count, fmt.Errorf("migration %d_%s has no down file", mig.Version, mig.Name)
+		}
+		if err := r.run(mig, mig.down); err != nil {
+			return count, err
+		}
+		_, err = r.db.Exec(r.bind("DELETE FROM "+Table+" WHERE version = ?"), mig.Version)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Status lists every known migration and whether it has been applied
+func (r *Runner) Status() ([]Status, error) {
+	applied, err := r.applied()
+	if err != nil {
+		return nil, err
+	}
+	var statuses []Status
+	for _, mig := range r.migrations {
+		s, ok := applied[mig.Version]
+		if !ok {
+			s = Status{Version: mig.Version}
+		}
+		s.Name = mig.Name
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// Force marks every migration up to and including version as cleanly applied
+// and every later one as not applied, without running any sql. It is used to
+// recover after a migration failed half way and was fixed by hand.
+func (r *Runner) Force(version int64) error {
+	if err := r.ensureTable(); err != nil {
+		return err
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(r.bind("DELETE FROM "+Table+" WHERE version > ?"), version)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(r.bind("UPDATE "+Table+" SET dirty = ? WHERE version <= ?"), false, version)
+	if err != nil {
+		return err
+	}
+	for _, mig := range r.migrations {
+		if mig.Version > version {
+			break
+		}
+		var exists int
+		err := tx.QueryRow(r.bind("SELECT count(*) FROM "+Table+" WHERE version = ?"), mig.Version).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			_, err = tx.Exec(r.bind("INSERT INTO "+Table+" (version, dirty) VALUES (?, ?)"), mig.Version, false)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// run executes one migration file. The version row is written as dirty
+// first, so a failure that leaves the schema half migrated is detected by
+// the next run instead of being silently retried.
+func (r *Runner) run(mig Migration, file string) error {
+	body, err := fs.ReadFile(r.fsys, file)
+	if err != nil {
+		return err
+	}
+	if file == mig.up {
+		_, err = r.db.Exec(r.bind("INSERT INTO "+Table+" (version, dirty) VALUES (?, ?)"), mig.Version, true)
+	} else {
+		_, err = r.db.Exec(r.bind("UPDATE "+Table+" SET dirty = ? WHERE version = ?"), true, mig.Version)
+	}
+	if err != nil {
+		return err
+	}
+	stmts := splitStatements(string(body))
+	if r.dialect == "sqlite" {
+		// trigger bodies end their statements with semicolons too; the sqlite
+		// driver runs every statement of a single Exec, so don't split at all
+		stmts = []string{string(body)}
+	}
+	for _, stmt := range stmts {
+		if _, err := r.db.Exec(stmt); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) ensureTable() error {
+	_, err := r.db.Exec(`CREATE TABLE IF NOT EXISTS ` + Table + ` (
+		version bigint NOT NULL PRIMARY KEY,
+		dirty boolean NOT NULL DEFAULT false,
+		applied_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+// applied returns the recorded versions, refusing to continue if one is dirty
+func (r *Runner) applied() (map[int64]Status, error) {
+	if err := r.ensureTable(); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query("SELECT version, dirty, applied_at FROM " + Table + " ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]Status)
+	for rows.Next() {
+		s := Status{Applied: true}
+		if err := rows.Scan(&s.Version, &s.Dirty, &s.AppliedAt); err != nil {
+			return nil, err
+		}
+		if s.Dirty {
+			return nil, &DirtyError{Version: s.Version}
+		}
+		applied[s.Version] = s
+	}
+	return applied, rows.Err()
+}
+
+// DirtyError is returned when a previous migration did not complete
+type DirtyError struct {
+	Version int64
+}
+
+func (e *DirtyError) Error() string {
+	return fmt.Sprintf("migration %d is dirty; fix the schema by hand and force a version", e.Version)
+}
+
+// IsDirty reports whether err is caused by a dirty migration
+func IsDirty(err error) bool {
+	var dirty *DirtyError
+	return errors.As(err, &dirty)
+}
+
+// bind rewrites ? placeholders to the $n form postgres expects
+func (r *Runner) bind(query string) string {
+	if r.dialect != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// splitStatements splits a file on the semicolons that end statements,
+// leaving the ones inside quotes, comments and $$ function bodies alone,
+// because not every driver accepts several statements in one Exec
+func splitStatements(body string) []string {
+	var stmts []string
+	var current strings.Builder
+	inQuote, inDollar, inComment := false, false, false
+
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case inComment:
+			if c == '\n' {
+				inComment = false
+			}
+		case inQuote:
+			if c == '\'' {
+				inQuote = false
+			}
+		case inDollar:
+			if c == '$' && i+1 < len(body) && body[i+1] == '$' {
+				inDollar = false
+				current.WriteByte(c)
+				i++
+			}
+		case c == '-' && i+1 < len(body) && body[i+1] == '-':
+			inComment = true
+		case c == '\'':
+			inQuote = true
+		case c == '$' && i+1 < len(body) && body[i+1] == '$':
+			inDollar = true
+			current.WriteByte(c)
+			i++
+		case c == ';':
+			flush()
+			continue
+		}
+		current.WriteByte(c)
+	}
+	flush()
+	return stmts
+}
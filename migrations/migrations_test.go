@@ -0,0 +1,146 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var testFS = fstest.MapFS{
+	"1_create_users.up.sql":             {Data: []byte("create table users (id int);")},
+	"1_create_users.down.sql":           {Data: []byte("drop table users;")},
+	"2_create_sessions.postgres.up.sql": {Data: []byte("create table sessions (token text);")},
+	"2_create_sessions.mysql.up.sql":    {Data: []byte("create table sessions (token char(43));")},
+	"2_create_sessions.up.sql":          {Data: []byte("create table sessions (token varchar(43));")},
+	"3_only_mysql.mysql.up.sql":         {Data: []byte("select 1;")},
+	"README.md":                         {Data: []byte("not a migration")},
+}
+
+func TestLoad(t *testing.T) {
+	migs, err := load(testFS, "postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migs) != 2 {
+		t.Fatalf("expected 2 migrations for postgres, got %d", len(migs))
+	}
+	if migs[0].Version != 1 || migs[1].Version != 2 {
+		t.Errorf("migrations out of order: %v", migs)
+	}
+	if migs[1].up != "2_create_sessions.postgres.up.sql" {
+		t.Errorf("expected the postgres variant, got %s", migs[1].up)
+	}
+
+	migs, err = load(testFS, Dialect("mariadb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migs) != 3 {
+		t.Fatalf("expected 3 migrations for mysql, got %d", len(migs))
+	}
+	if migs[1].up != "2_create_sessions.mysql.up.sql" {
+		t.Errorf("expected the mysql variant, got %s", migs[1].up)
+	}
+}
+
+func TestLoad_Embedded(t *testing.T) {
+	for _, dialect := range []string{"postgres", "mysql", "sqlite"} {
+		migs, err := load(files, dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migs) == 0 {
+			t.Errorf("no embedded migrations for %s", dialect)
+		}
+		for _, m := range migs {
+			if m.down == "" {
+				t.Errorf("%s: migration %d has no down file", dialect, m.Version)
+			}
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	body := `
+CREATE OR REPLACE FUNCTION f()
+RETURNS TRIGGER AS $$
+BEGIN
+  NEW.updated_at = NOW();
+RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- a comment; with a semicolon
+insert into t (s) values ('a;b');
+drop table x`
+	stmts := splitStatements(body)
+	if len(stmts) != 3 {
+		t.Fatalf("expected 3 statements, got %d: %q", len(stmts), stmts)
+	}
+}
+
+func TestBind(t *testing.T) {
+	r := &Runner{dialect: "postgres"}
+	if q := r.bind("UPDATE t SET a = ? WHERE b = ?"); q != "UPDATE t SET a = $1 WHERE b = $2" {
+		t.Errorf("unexpected postgres query %s", q)
+	}
+	r.dialect = "mysql"
+	if q := r.bind("UPDATE t SET a = ?"); q != "UPDATE t SET a = ?" {
+		t.Errorf("unexpected mysql query %s", q)
+	}
+}
+
+func TestRunner_Up(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	r, err := NewWithFS(db, "postgres", testFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_versions").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version, dirty, applied_at FROM schema_versions").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty", "applied_at"}).AddRow(1, false, time.Now()))
+	mock.ExpectExec("INSERT INTO schema_versions").WithArgs(2, true).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("create table sessions").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE schema_versions SET dirty").WithArgs(false, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	n, err := r.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 migration applied, got %d", n)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunner_Dirty(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	r, err := NewWithFS(db, "postgres", testFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_versions").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version, dirty, applied_at FROM schema_versions").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty", "applied_at"}).AddRow(1, true, time.Now()))
+
+	_, err = r.Up()
+	if !IsDirty(err) {
+		t.Errorf("expected a dirty error, got %v", err)
+	}
+}
@@ -1,92 +1,72 @@
 package main
 
 import (
-	"fmt"
 	"net/http"
-	"strconv"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/prateekjoshi2013/scotch-primer/data"
+	"github.com/prateekjoshi2013/scotch-primer/metrics"
+	"github.com/prateekjoshi2013/scotch-primer/middlewares"
 )
 
 func (a *application) routes() *chi.Mux {
 	//middleware must come before routes
+	a.use(a.Middleware.RealIP(a.Config.TrustedProxies))
+	a.use(a.Middleware.RequestLogger)
+	a.use(a.Middleware.Metrics)
+	a.use(a.Middleware.SecurityHeaders(a.Config.Secure))
 
-	// add routes here
-	a.get("/", a.Handlers.Home)
-	a.get("/go-page", a.Handlers.GoPage)
-	a.get("/jet-page", a.Handlers.JetPage)
-	a.get("/sessions", a.Handlers.SessionTest)
-	a.get("/users/login", a.Handlers.UserLogin)
-	a.post("/users/login", a.Handlers.PostUserLogin)
-	a.get("/users/logout", a.Handlers.UserLogout)
-	a.get("/form", a.Handlers.Form)
-	a.post("/form", a.Handlers.SubmitForm)
+	// probes for load balancers and orchestrators, and the metrics for the
+	// scraper, are outside the rate limits: they poll from a few addresses on
+	// their own schedule, and a refused probe takes the instance out of
+	// rotation
+	a.get("/healthz", a.Health.Liveness)
+	a.get("/readyz", a.Health.Readiness)
+	if a.Config.Metrics.Enabled {
+		a.App.Routes.Handle("/metrics", metrics.Handler(a.Config.Metrics.Token))
+	}
 
-	// testing user orm config
-	a.get("/create-user", func(w http.ResponseWriter, r *http.Request) {
-		u := data.User{
-			FirstName: "trevor",
-			LastName:  "Sawler",
-			Email:     "me@here.com",
-			Active:    1,
-			Password:  "password",
-		}
-		id, err := a.Models.Users.Insert(u)
-		if err != nil {
-			a.App.ErrorLog.Println(err)
-		}
-		fmt.Fprintf(w, "%d: %s", id, u.FirstName)
-	})
-
-	a.get("/get-all-users", func(w http.ResponseWriter, r *http.Request) {
-		users, err := a.Models.Users.GetAll()
-		if err != nil {
-			a.App.ErrorLog.Println(err)
-		}
-		for _, x := range users {
-			fmt.Fprintf(w, x.LastName)
-		}
-	})
+	a.App.Routes.NotFound(a.Handlers.NotFound)
+	a.App.Routes.MethodNotAllowed(a.Handlers.MethodNotAllowed)
 
-	a.get("/get-user/{id}", func(w http.ResponseWriter, r *http.Request) {
-		id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-		u, err := a.Models.Users.Get(id)
-		if err != nil {
-			a.App.ErrorLog.Println(err)
-			return
+	a.App.Routes.Group(func(r chi.Router) {
+		r.Use(a.rateLimit("default", a.Config.RateLimit.Default, middlewares.TokenBucket, a.Middleware.KeyByUser))
+		if a.Config.CSRF.Enabled {
+			r.Use(a.Middleware.CSRF(a.Config.Cookie.Secure, a.Config.Cookie.Domain, http.HandlerFunc(a.Handlers.CSRFFailure)))
 		}
-		fmt.Fprintf(w, "%s %s %s", u.FirstName, u.LastName, u.Email)
 
-	})
+		// add routes here; handlers returning an error are wrapped with handle
+		r.Get("/", a.handle(a.Handlers.Home))
+		r.Get("/go-page", a.handle(a.Handlers.GoPage))
+		r.Get("/jet-page", a.handle(a.Handlers.JetPage))
+		r.Get("/sessions", a.handle(a.Handlers.SessionTest))
+		r.Get("/users/login", a.handle(a.Handlers.UserLogin))
+		// a strict window per address slows down password guessing
+		r.With(a.rateLimit("login", a.Config.RateLimit.Login, middlewares.SlidingWindow, middlewares.KeyByIP)).
+			Post("/users/login", a.handle(a.Handlers.PostUserLogin))
+		r.Get("/users/logout", a.Handlers.UserLogout)
+		r.Get("/form", a.handle(a.Handlers.Form))
+		r.Post("/form", a.handle(a.Handlers.SubmitForm))
 
-	a.get("/update-user/{id}", func(w http.ResponseWriter, r *http.Request) {
-		id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-		u, err := a.Models.Users.Get(id)
-		if err != nil {
-			a.App.ErrorLog.Println(err)
-			return
-		}
-		u.LastName = a.App.RandomString(10)
-		validator := a.App.Validator(nil)
-		u.LastName = ""
-		u.Validate(validator)
-		if !validator.Valid() {
-			fmt.Fprint(w, "failed validation")
-			return
-		}
-		err = a.Models.Users.Update(u)
+		// the json api, for clients with a bearer token; only it accepts
+		// cross origin requests
+		r.Route("/api", func(r chi.Router) {
+			cors := a.Config.CORS
+			r.Use(a.Middleware.CORS(middlewares.CORSOptions{
+				AllowedOrigins:   cors.AllowedOrigins,
+				AllowedMethods:   cors.AllowedMethods,
+				AllowedHeaders:   cors.AllowedHeaders,
+				ExposedHeaders:   cors.ExposedHeaders,
+				AllowCredentials: cors.AllowCredentials,
+				MaxAge:           cors.MaxAge,
+			}))
+			r.Use(a.rateLimit("api", a.Config.RateLimit.API, middlewares.TokenBucket, middlewares.KeyByToken))
+			r.Use(a.Middleware.AuthToken)
+			r.Get("/me", a.handle(a.Handlers.APIMe))
+		})
 
-		if err != nil {
-			a.App.ErrorLog.Println(err)
-			return
-		}
-		fmt.Fprintf(w, "%s %s %s", u.FirstName, u.LastName, u.Email)
+		// static routes, without directory listings
+		r.Handle("/public/*", http.StripPrefix("/public", a.Assets.Handler(http.HandlerFunc(a.Handlers.NotFound))))
 	})
 
-	// static routes
-	fileServer := http.FileServer(http.Dir("./public"))
-	a.App.Routes.Handle("/public/*", http.StripPrefix("/public", fileServer))
-
 	return a.App.Routes
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prateekjoshi2013/scotch"
+	"github.com/prateekjoshi2013/scotch-primer/assets"
+	"github.com/prateekjoshi2013/scotch-primer/config"
+	"github.com/prateekjoshi2013/scotch-primer/handlers"
+	"github.com/prateekjoshi2013/scotch-primer/health"
+	"github.com/prateekjoshi2013/scotch-primer/middlewares"
+)
+
+func TestRoutes_ProbesAreNotRateLimited(t *testing.T) {
+	app := &scotch.Scotch{Routes: chi.NewRouter()}
+	static, err := assets.New(fstest.MapFS{}, "/public", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &application{
+		App:        app,
+		Config:     &config.Config{RateLimit: config.RateLimit{Enabled: true, Default: 1}},
+		Handlers:   &handlers.Handlers{App: app},
+		Middleware: &middlewares.Middleware{App: app},
+		Health:     health.New("test"),
+		Assets:     static,
+		RateLimits: middlewares.NewMemoryRateLimitStore(),
+	}
+	routes := a.routes()
+
+	get := func(path string) int {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, r)
+		return rr.Code
+	}
+	for i := 0; i < 3; i++ {
+		if code := get("/healthz"); code != http.StatusOK {
+			t.Fatalf("expected the probe to answer every time, got %d on request %d", code, i+1)
+		}
+	}
+	if code := get("/public/missing.css"); code != http.StatusNotFound {
+		t.Errorf("expected the first request to get through, got %d", code)
+	}
+	if code := get("/public/missing.css"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the default limit on the other routes, got %d", code)
+	}
+}
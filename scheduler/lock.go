@@ -0,0 +1,105 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+
+	"github.com/prateekjoshi2013/scotch-primer/migrations"
+)
+
+// Locker hands out the locks that keep a task from running on two instances
+// at once
+type Locker interface {
+	// TryLock takes the lock called name without waiting. It returns false
+	// when the lock is held elsewhere, or the function that releases it.
+	TryLock(ctx context.Context, name string) (unlock func(), ok bool, err error)
+}
+
+// lockPrefix namespaces the task locks among the other advisory locks of
+// the database
+const lockPrefix = "scotch.task."
+
+// NewLocker returns a Locker using the advisory locks of db, a database of
+// the given DATABASE_TYPE. sqlite has no such locks, so there the locks only
+// hold within this process.
+func NewLocker(db *sql.DB, databaseType string) Locker {
+	dialect := migrations.Dialect(databaseType)
+	if db == nil || dialect == "sqlite" {
+		return &LocalLocker{}
+	}
+	return &advisoryLocker{db: db, dialect: dialect}
+}
+
+// advisoryLocker uses pg_try_advisory_lock on postgres and GET_LOCK on mysql.
+// Both locks belong to the connection, so the connection is held until the
+// lock is released.
+type advisoryLocker struct {
+	db      *sql.DB
+	dialect string
+}
+
+func (l *advisoryLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var (
+		lockQuery, unlockQuery string
+		key                    interface{}
+	)
+	if l.dialect == "mysql" {
+		lockQuery, unlockQuery = "select coalesce(get_lock(?, 0), 0) = 1", "select release_lock(?)"
+		key = lockPrefix + name
+	} else {
+		lockQuery, unlockQuery = "select pg_try_advisory_lock($1)", "select pg_advisory_unlock($1)"
+		key = lockKey(name)
+	}
+
+	var ok bool
+	if err := conn.QueryRowContext(ctx, lockQuery, key).Scan(&ok); err != nil || !ok {
+		conn.Close()
+		return nil, false, err
+	}
+	return func() {
+		// the lock must be released even when the run was cancelled
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx), unlockQuery, key); err != nil {
+			slog.Error("releasing task lock", "task", name, "error", err)
+		}
+		conn.Close()
+	}, true, nil
+}
+
+// lockKey turns a lock name into the bigint key of a postgres advisory lock
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(lockPrefix + name))
+	return int64(h.Sum64())
+}
+
+// LocalLocker is a Locker whose locks only hold within the process
+type LocalLocker struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (l *LocalLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := l.locks[name]
+	if !ok {
+		lock = &sync.Mutex{}
+		l.locks[name] = lock
+	}
+	l.mu.Unlock()
+
+	if !lock.TryLock() {
+		return nil, false, nil
+	}
+	return lock.Unlock, true, nil
+}
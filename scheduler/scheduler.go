@@ -0,0 +1,195 @@
+// Package scheduler runs registered maintenance tasks on cron schedules
+// inside the application process.
+//
+// Every run takes a lock named after the task first, so that when several
+// instances of the app share a database only one of them runs each task; the
+// others skip it. Tasks should be safe to run twice, since an instance whose
+// clock is late may take the lock just after another has released it.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/prateekjoshi2013/scotch-primer/logging"
+	"github.com/prateekjoshi2013/scotch-primer/metrics"
+	"github.com/prateekjoshi2013/scotch-primer/tracing"
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrUnknownTask = errors.New("no such task")
+
+// Task is the work of a scheduled task
+type Task func(ctx context.Context) error
+
+// Entry describes a registered task
+type Entry struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	Next     time.Time `json:"next"`
+}
+
+type Scheduler struct {
+	cron   *cron.Cron
+	locker Locker
+	tasks  map[string]Task
+	names  []string
+	specs  map[string]string
+	next   map[string]cron.Schedule
+
+	// ctx is the parent of every run; cancel interrupts the runs Stop gave
+	// up waiting for
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	started bool
+}
+
+// New returns a scheduler whose runs take their locks from locker
+func New(locker Locker) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		cron:   cron.New(),
+		locker: locker,
+		tasks:  make(map[string]Task),
+		specs:  make(map[string]string),
+		next:   make(map[string]cron.Schedule),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Add registers task to run on schedule, a standard five field cron
+// expression or a descriptor such as @hourly
+func (s *Scheduler) Add(name, schedule string, task Task) error {
+	if _, ok := s.tasks[name]; ok {
+		return fmt.Errorf("task %s is already registered", name)
+	}
+	sched, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return fmt.Errorf("task %s: invalid schedule %q: %w", name, schedule, err)
+	}
+	s.cron.Schedule(sched, cron.FuncJob(func() {
+		_ = s.run(s.ctx, name)
+	}))
+	s.tasks[name] = task
+	s.specs[name] = schedule
+	s.next[name] = sched
+	s.names = append(s.names, name)
+	return nil
+}
+
+// Entries returns the registered tasks in registration order
+func (s *Scheduler) Entries() []Entry {
+	now := time.Now()
+	entries := make([]Entry, 0, len(s.names))
+	for _, name := range s.names {
+		entries = append(entries, Entry{
+			Name:     name,
+			Schedule: s.specs[name],
+			Next:     s.next[name].Next(now),
+		})
+	}
+	return entries
+}
+
+// Start starts running the tasks on their schedules. ctx is not used: the
+// runs carry on until Stop.
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return errors.New("scheduler already started")
+	}
+	s.started = true
+	s.cron.Start()
+	slog.Info("scheduler started", "tasks", len(s.names))
+	return nil
+}
+
+// Stop stops scheduling runs and waits for the running ones until ctx is
+// done, when they are cancelled
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		return nil
+	}
+	s.started = false
+	select {
+	case <-s.cron.Stop().Done():
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		return fmt.Errorf("tasks still running: %w", ctx.Err())
+	}
+}
+
+// Run runs the task name now, under its lock, and returns its error. A run
+// skipped because another instance holds the lock is not an error.
+func (s *Scheduler) Run(ctx context.Context, name string) error {
+	if _, ok := s.tasks[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownTask, name)
+	}
+	return s.run(ctx, name)
+}
+
+func (s *Scheduler) run(ctx context.Context, name string) error {
+	logger := slog.Default().With("task", name)
+
+	unlock, ok, err := s.locker.TryLock(ctx, name)
+	if err != nil {
+		metrics.TaskRuns.WithLabelValues(name, "error").Inc()
+		logger.Error("taking task lock", "error", err)
+		return err
+	}
+	if !ok {
+		metrics.TaskRuns.WithLabelValues(name, "skipped").Inc()
+		logger.Debug("task skipped, it is running elsewhere")
+		return nil
+	}
+	defer unlock()
+
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "task "+name,
+		trace.WithAttributes(attribute.String("task.name", name)))
+	if span.SpanContext().IsValid() {
+		logger = logger.With("trace_id", span.SpanContext().TraceID().String())
+	}
+	ctx = logging.NewContext(ctx, logger)
+
+	err = s.call(ctx, name)
+	duration := time.Since(start)
+	tracing.End(span, err)
+
+	outcome := "success"
+	attrs := []interface{}{"duration_ms", float64(duration.Microseconds()) / 1000}
+	if err != nil {
+		outcome = "error"
+		logger.Error("task failed", append(attrs, "error", err)...)
+	} else {
+		metrics.TaskLastSuccess.WithLabelValues(name).SetToCurrentTime()
+		logger.Info("task finished", attrs...)
+	}
+	metrics.TaskRuns.WithLabelValues(name, outcome).Inc()
+	metrics.TaskDuration.WithLabelValues(name).Observe(duration.Seconds())
+	return err
+}
+
+// call runs the task, turning a panic into an error
+func (s *Scheduler) call(ctx context.Context, name string) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v\n%s", v, debug.Stack())
+		}
+	}()
+	return s.tasks[name](ctx)
+}
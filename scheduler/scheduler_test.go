@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAdd(t *testing.T) {
+	s := New(&LocalLocker{})
+	noop := func(ctx context.Context) error { return nil }
+	if err := s.Add("purge", "@hourly", noop); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("purge", "@daily", noop); err == nil {
+		t.Error("expected a task name to be registered only once")
+	}
+	if err := s.Add("broken", "every now and then", noop); err == nil || !strings.Contains(err.Error(), "invalid schedule") {
+		t.Errorf("expected an invalid schedule to be refused, got %v", err)
+	}
+
+	entries := s.Entries()
+	if len(entries) != 1 || entries[0].Name != "purge" || entries[0].Next.IsZero() {
+		t.Errorf("expected the task with its next run, got %+v", entries)
+	}
+}
+
+func TestRun(t *testing.T) {
+	s := New(&LocalLocker{})
+	runs := 0
+	s.Add("purge", "@hourly", func(ctx context.Context) error {
+		runs++
+		return nil
+	})
+	s.Add("broken", "@hourly", func(ctx context.Context) error {
+		panic("oops")
+	})
+
+	ctx := context.Background()
+	if err := s.Run(ctx, "purge"); err != nil || runs != 1 {
+		t.Errorf("expected the task to run, got %d runs and %v", runs, err)
+	}
+	if err := s.Run(ctx, "broken"); err == nil || !strings.Contains(err.Error(), "panic: oops") {
+		t.Errorf("expected the panic to be returned, got %v", err)
+	}
+	if err := s.Run(ctx, "missing"); !errors.Is(err, ErrUnknownTask) {
+		t.Errorf("expected ErrUnknownTask, got %v", err)
+	}
+}
+
+func TestRun_SkipsWhenLocked(t *testing.T) {
+	locker := &LocalLocker{}
+	s := New(locker)
+	runs := 0
+	s.Add("purge", "@hourly", func(ctx context.Context) error {
+		runs++
+		return nil
+	})
+
+	unlock, ok, _ := locker.TryLock(context.Background(), "purge")
+	if !ok {
+		t.Fatal("expected to take the lock")
+	}
+	if err := s.Run(context.Background(), "purge"); err != nil || runs != 0 {
+		t.Errorf("expected the run to be skipped, got %d runs and %v", runs, err)
+	}
+	unlock()
+	if err := s.Run(context.Background(), "purge"); err != nil || runs != 1 {
+		t.Errorf("expected the task to run once the lock is free, got %d runs and %v", runs, err)
+	}
+}
+
+func TestAdvisoryLocker_Postgres(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	key := lockKey("purge")
+
+	mock.ExpectQuery(`select pg_try_advisory_lock\(\$1\)`).WithArgs(key).
+		WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(true))
+	mock.ExpectExec(`select pg_advisory_unlock\(\$1\)`).WithArgs(key).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`select pg_try_advisory_lock\(\$1\)`).WithArgs(key).
+		WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(false))
+
+	l := NewLocker(db, "postgres")
+	unlock, ok, err := l.TryLock(context.Background(), "purge")
+	if err != nil || !ok {
+		t.Fatalf("expected the lock, got %v, %v", ok, err)
+	}
+	unlock()
+	if _, ok, err := l.TryLock(context.Background(), "purge"); err != nil || ok {
+		t.Errorf("expected the lock to be held elsewhere, got %v, %v", ok, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
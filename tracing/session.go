@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SessionStore wraps store so that every load, save and delete of a session
+// is recorded as a span of the request that caused it
+func SessionStore(store scs.Store, storeType string) scs.Store {
+	return &sessionStore{store: store, storeType: storeType}
+}
+
+type sessionStore struct {
+	store     scs.Store
+	storeType string
+}
+
+func (s *sessionStore) start(ctx context.Context, op string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "session "+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("session.store", s.storeType)))
+}
+
+func (s *sessionStore) FindCtx(ctx context.Context, token string) (b []byte, found bool, err error) {
+	ctx, span := s.start(ctx, "find")
+	defer func() {
+		span.SetAttributes(attribute.Bool("session.found", found))
+		End(span, err)
+	}()
+	if cs, ok := s.store.(scs.CtxStore); ok {
+		return cs.FindCtx(ctx, token)
+	}
+	return s.store.Find(token)
+}
+
+func (s *sessionStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) (err error) {
+	ctx, span := s.start(ctx, "commit")
+	defer func() { End(span, err) }()
+	if cs, ok := s.store.(scs.CtxStore); ok {
+		return cs.CommitCtx(ctx, token, b, expiry)
+	}
+	return s.store.Commit(token, b, expiry)
+}
+
+func (s *sessionStore) DeleteCtx(ctx context.Context, token string) (err error) {
+	ctx, span := s.start(ctx, "delete")
+	defer func() { End(span, err) }()
+	if cs, ok := s.store.(scs.CtxStore); ok {
+		return cs.DeleteCtx(ctx, token)
+	}
+	return s.store.Delete(token)
+}
+
+func (s *sessionStore) Find(token string) ([]byte, bool, error) {
+	return s.FindCtx(context.Background(), token)
+}
+
+func (s *sessionStore) Commit(token string, b []byte, expiry time.Time) error {
+	return s.CommitCtx(context.Background(), token, b, expiry)
+}
+
+func (s *sessionStore) Delete(token string) error {
+	return s.DeleteCtx(context.Background(), token)
+}
+
+// StopCleanup stops the cleanup goroutine of the database backed stores
+func (s *sessionStore) StopCleanup() {
+	if c, ok := s.store.(interface{ StopCleanup() }); ok {
+		c.StopCleanup()
+	}
+}
@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2/memstore"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetup_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	flush, err := Setup(context.Background(), Config{ServiceName: "test", Exporter: "file", File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := Tracer().Start(context.Background(), "work")
+	span.End()
+	if err := flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one line of otlp json, got %q", b)
+	}
+	var data struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID string `json:"traceId"`
+					Name    string `json:"name"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &data); err != nil {
+		t.Fatal(err)
+	}
+	spans := data.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 1 || spans[0].Name != "work" {
+		t.Fatalf("expected the work span, got %v", spans)
+	}
+	if spans[0].TraceID != span.SpanContext().TraceID().String() {
+		t.Errorf("expected a hex trace id, got %q", spans[0].TraceID)
+	}
+}
+
+func TestSetup_Unknown(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{Exporter: "carrier-pigeon"}); err == nil {
+		t.Error("expected an error for an unknown exporter")
+	}
+}
+
+func TestSessionStore(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	store := SessionStore(memstore.NewWithCleanupInterval(0), "memory")
+	if err := store.Commit("token", []byte("data"), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	b, found, err := store.Find("token")
+	if err != nil || !found || string(b) != "data" {
+		t.Fatalf("expected the stored session, got %q %v %v", b, found, err)
+	}
+
+	var names []string
+	for _, s := range recorder.Ended() {
+		names = append(names, s.Name())
+	}
+	if strings.Join(names, ",") != "session commit,session find" {
+		t.Errorf("expected a span per store call, got %v", names)
+	}
+}